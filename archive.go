@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveKinds lists the archive names recognised for extraction, with the
+// tar compression flag for each kind.
+var archiveKinds = []struct {
+	suffix, kind, tarFlag string
+}{
+	{".tar.gz", "tar.gz", "z"},
+	{".tgz", "tar.gz", "z"},
+	{".tar.bz2", "tar.bz2", "j"},
+	{".tbz2", "tar.bz2", "j"},
+	{".tar.xz", "tar.xz", "J"},
+	{".txz", "tar.xz", "J"},
+	{".tar", "tar", ""},
+	{".zip", "zip", ""},
+}
+
+const (
+	progressInterval   = 100 * time.Millisecond
+	maxListedConflicts = 20
+)
+
+type ArchiveProgress struct {
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Current string `json:"current"`
+}
+
+// splitArchiveName returns the name without its archive suffix, the kind of
+// archive and the tar compression flag, or an empty kind when the name is not
+// a supported archive.
+func splitArchiveName(name string) (string, string, string) {
+	lower := strings.ToLower(name)
+	for _, k := range archiveKinds {
+		if strings.HasSuffix(lower, k.suffix) && len(name) > len(k.suffix) {
+			return name[:len(name)-len(k.suffix)], k.kind, k.tarFlag
+		}
+	}
+	return name, "", ""
+}
+
+// countRemoteLines counts the lines printed by cmd, used to know how many
+// entries an archive operation will go through. It returns 0 when unknown.
+func countRemoteLines(cmd string) int {
+	output, err := runRemoteCommand(cmd + " | wc -l")
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(output)))
+	return n
+}
+
+// archiveConflicts lists the entries of an archive that already exist as
+// files in dest, returning at most maxListedConflicts names and the total.
+func archiveConflicts(ctx context.Context, list, dest string) ([]string, int, error) {
+	target := shellQuote(dest) + `/"$f"`
+	cmd := list + ` | while IFS= read -r f; do if [ -f ` + target + ` ] || [ -L ` + target + ` ]; then printf '%s\n' "$f"; fi; done`
+
+	var conflicts []string
+	count := 0
+	err := streamRemoteLines(ctx, cmd, func(line string) bool {
+		count++
+		if len(conflicts) < maxListedConflicts {
+			conflicts = append(conflicts, line)
+		}
+		return true
+	})
+	return conflicts, count, err
+}
+
+// progressReporter sends "progress" events, at most every progressInterval.
+type progressReporter struct {
+	w        http.ResponseWriter
+	progress ArchiveProgress
+	last     time.Time
+}
+
+func (p *progressReporter) step(current string) {
+	p.progress.Done++
+	p.progress.Current = current
+	if time.Since(p.last) >= progressInterval {
+		p.flush()
+	}
+}
+
+func (p *progressReporter) flush() {
+	p.last = time.Now()
+	writeEvent(p.w, "progress", p.progress)
+}
+
+// createArchiveWithSFTP builds the archive on the ssh-editor side and writes
+// it back, for servers without tar or zip.
+func createArchiveWithSFTP(src, target, format string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		if format == "zip" {
+			writer.CloseWithError(writeZipWithSFTP(writer, src))
+		} else {
+			writer.CloseWithError(writeTarGzWithSFTP(writer, src))
+		}
+	}()
+	defer reader.Close()
+
+	var err error
+	if server.useSudo {
+		_, err = writeStreamWithSudo(target, reader)
+	} else {
+		_, err = writeStreamWithSFTP(target, reader)
+	}
+	return err
+}
+
+// handleArchiveCreate compresses a file or folder into a tar.gz or zip
+// archive next to it, streaming "progress" events and a final "done" event.
+func handleArchiveCreate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if err := checkCommandRequest(r); err != nil {
+		writeEvent(w, "done", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if server.sftpClient == nil {
+		writeEvent(w, "done", map[string]interface{}{"error": "Non connecté"})
+		return
+	}
+
+	query := r.URL.Query()
+	src := cleanRemotePath(query.Get("path"))
+	if src == "" || src == "/" {
+		writeEvent(w, "done", map[string]interface{}{"error": "Chemin invalide"})
+		return
+	}
+	format := query.Get("format")
+	if format != "tar.gz" && format != "zip" {
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Format inconnu: %s", format)})
+		return
+	}
+	name := query.Get("name")
+	if name == "" {
+		name = path.Base(src) + "." + format
+	}
+	if strings.Contains(name, "/") || name == "." || name == ".." {
+		writeEvent(w, "done", map[string]interface{}{"error": "Nom d'archive invalide"})
+		return
+	}
+
+	parent := path.Dir(src)
+	target := path.Join(parent, name)
+	if remoteExists(target) {
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("%s existe déjà", target)})
+		return
+	}
+
+	reporter := &progressReporter{w: w}
+	tool := "tar"
+	if format == "zip" {
+		tool = "zip"
+	}
+
+	var err error
+	if remoteCommandExists(tool) {
+		reporter.progress.Total = countRemoteLines("find " + shellQuote(src))
+		reporter.flush()
+		if format == "zip" {
+			// zip has no end-of-options marker; "./" keeps names starting
+			// with a dash from being read as options and is not stored.
+			err = streamRemoteLines(r.Context(), fmt.Sprintf("cd %s && zip -r %s %s",
+				shellQuote(parent), shellQuote(target), shellQuote("./"+path.Base(src))), func(line string) bool {
+				if entry, ok := strings.CutPrefix(strings.TrimSpace(line), "adding: "); ok {
+					if i := strings.LastIndex(entry, " ("); i > 0 {
+						entry = entry[:i]
+					}
+					reporter.step(entry)
+				}
+				return true
+			})
+		} else {
+			err = streamRemoteLines(r.Context(), fmt.Sprintf("tar -czvf %s -C %s -- %s",
+				shellQuote(target), shellQuote(parent), shellQuote(path.Base(src))), func(line string) bool {
+				reporter.step(line)
+				return true
+			})
+		}
+	} else {
+		reporter.flush()
+		err = createArchiveWithSFTP(src, target, format)
+	}
+
+	if err != nil {
+		// A partial archive is of no use.
+		removeRemote(target)
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+		return
+	}
+	reporter.flush()
+	writeEvent(w, "done", map[string]interface{}{"path": target, "count": reporter.progress.Done})
+}
+
+// handleArchiveExtract extracts an archive in its folder, either into a new
+// folder named after it (default) or directly alongside it ("into=here").
+func handleArchiveExtract(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if err := checkCommandRequest(r); err != nil {
+		writeEvent(w, "done", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if server.sftpClient == nil {
+		writeEvent(w, "done", map[string]interface{}{"error": "Non connecté"})
+		return
+	}
+
+	query := r.URL.Query()
+	archive := cleanRemotePath(query.Get("path"))
+	base, kind, tarFlag := splitArchiveName(path.Base(archive))
+	if archive == "" || kind == "" {
+		writeEvent(w, "done", map[string]interface{}{"error": "Format d'archive non reconnu"})
+		return
+	}
+
+	dest := path.Dir(archive)
+	if query.Get("into") != "here" {
+		dest = path.Join(dest, base)
+		if remoteExists(dest) {
+			writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("%s existe déjà", dest)})
+			return
+		}
+	}
+
+	tool := "tar"
+	if kind == "zip" {
+		tool = "unzip"
+	}
+	if !remoteCommandExists(tool) {
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("%s n'est pas installé sur le serveur", tool)})
+		return
+	}
+
+	// Existing files are only replaced once the user has confirmed it after
+	// seeing the conflicts; otherwise they are kept.
+	overwrite := query.Get("overwrite") == "1"
+	var list, extract string
+	if kind == "zip" {
+		list = "unzip -Z1 " + shellQuote(archive)
+		option := "-n"
+		if overwrite {
+			option = "-o"
+		}
+		extract = fmt.Sprintf("unzip %s %s -d %s", option, shellQuote(archive), shellQuote(dest))
+	} else {
+		list = fmt.Sprintf("tar -t%sf %s", tarFlag, shellQuote(archive))
+		option := "k"
+		if overwrite {
+			option = ""
+		}
+		extract = fmt.Sprintf("tar -x%s%svf %s -C %s", option, tarFlag, shellQuote(archive), shellQuote(dest))
+	}
+
+	if dest == path.Dir(archive) && !overwrite {
+		conflicts, count, err := archiveConflicts(r.Context(), list, dest)
+		if err != nil {
+			writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+			return
+		}
+		if count > 0 {
+			writeEvent(w, "done", map[string]interface{}{
+				"error":         fmt.Sprintf("%d fichier(s) existent déjà", count),
+				"conflicts":     conflicts,
+				"conflictCount": count,
+			})
+			return
+		}
+	}
+
+	reporter := &progressReporter{w: w}
+	reporter.progress.Total = countRemoteLines(list)
+	reporter.flush()
+
+	if dest != path.Dir(archive) {
+		if err := mkdirRemote(dest); err != nil {
+			writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+			return
+		}
+	}
+
+	err := streamRemoteLines(r.Context(), extract, func(line string) bool {
+		if kind != "zip" {
+			reporter.step(line)
+			return true
+		}
+		// unzip prints "  inflating: dest/file", "   creating: dest/dir/"...
+		verb, entry, ok := strings.Cut(strings.TrimSpace(line), ": ")
+		if ok && verb != "Archive" {
+			reporter.step(strings.TrimPrefix(strings.TrimSpace(entry), dest+"/"))
+		}
+		return true
+	})
+	if err != nil {
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err), "path": dest})
+		return
+	}
+	reporter.flush()
+	writeEvent(w, "done", map[string]interface{}{"path": dest, "count": reporter.progress.Done})
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const maxCompareEntries = 20000
+
+// compareSide is one end of a comparison: a path on the current connection,
+// or on another server when a connection is given.
+type compareSide struct {
+	Path       string          `json:"path"`
+	Connection *ConnectRequest `json:"connection"`
+
+	label     string
+	sshClient *ssh.Client
+	client    *sftp.Client
+}
+
+type SideBySideLine struct {
+	Num  int    `json:"num"`
+	Text string `json:"text"`
+}
+
+type SideBySideRow struct {
+	Kind  string          `json:"kind"`
+	Left  *SideBySideLine `json:"left,omitempty"`
+	Right *SideBySideLine `json:"right,omitempty"`
+	Count int             `json:"count,omitempty"`
+}
+
+type CompareEntry struct {
+	Path      string `json:"path"`
+	IsDir     bool   `json:"isDir"`
+	LeftSize  int64  `json:"leftSize"`
+	RightSize int64  `json:"rightSize"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type DirComparison struct {
+	Type      string         `json:"type"`
+	Left      string         `json:"left"`
+	Right     string         `json:"right"`
+	OnlyLeft  []CompareEntry `json:"onlyLeft"`
+	OnlyRight []CompareEntry `json:"onlyRight"`
+	Differing []CompareEntry `json:"differing"`
+	Identical []CompareEntry `json:"identical"`
+	Truncated bool           `json:"truncated"`
+}
+
+func (c *compareSide) open() error {
+	c.Path = cleanRemotePath(c.Path)
+	if c.Path == "" {
+		return fmt.Errorf("chemin requis")
+	}
+
+	if c.Connection == nil {
+		if server.sftpClient == nil {
+			return fmt.Errorf("non connecté")
+		}
+		c.client = server.sftpClient
+		c.label = server.host
+		return nil
+	}
+
+	if c.Connection.Port == "" {
+		c.Connection.Port = "22"
+	}
+	client, sftpClient, err := dialRemote(*c.Connection)
+	if err != nil {
+		return err
+	}
+	c.sshClient, c.client = client, sftpClient
+	c.label = fmt.Sprintf("%s@%s:%s", c.Connection.Username, c.Connection.Host, c.Connection.Port)
+	return nil
+}
+
+func (c *compareSide) close() {
+	if c.sshClient != nil {
+		c.client.Close()
+		c.sshClient.Close()
+	}
+}
+
+// usesSudo reports whether reads go through the privileged backend of the
+// current connection.
+func (c *compareSide) usesSudo() bool {
+	return c.Connection == nil && server.useSudo
+}
+
+func (c *compareSide) readFile(p string) ([]byte, error) {
+	if c.usesSudo() {
+		return readRemoteFile(p)
+	}
+	file, err := c.client.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func (c *compareSide) hashFile(p string) (string, error) {
+	hash := sha256.New()
+	if c.usesSudo() {
+		// Streamed into the hash: these are the files too large to load.
+		if err := streamRemoteCommand("cat -- "+shellQuote(p), hash); err != nil {
+			return "", err
+		}
+	} else {
+		file, err := c.client.Open(p)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// walk lists every entry below the side's path, keyed by relative path.
+func (c *compareSide) walk() (map[string]os.FileInfo, bool) {
+	entries := map[string]os.FileInfo{}
+	walker := c.client.Walk(c.Path)
+	for walker.Step() {
+		if walker.Err() != nil || walker.Path() == c.Path {
+			continue
+		}
+		if len(entries) >= maxCompareEntries {
+			return entries, true
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), c.Path), "/")
+		entries[rel] = walker.Stat()
+	}
+	return entries, false
+}
+
+// sideBySide pairs removed and added lines of each change so that the two
+// versions can be shown in parallel columns. Long unchanged runs are folded
+// into a "skip" row.
+func sideBySide(ops []DiffOp, context int) []SideBySideRow {
+	var rows []SideBySideRow
+	oldNum, newNum := 0, 0
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == '=' {
+			j := i
+			for j < len(ops) && ops[j].Kind == '=' {
+				j++
+			}
+			keepHead, keepTail := context, context
+			if i == 0 {
+				keepHead = 0
+			}
+			if j == len(ops) {
+				keepTail = 0
+			}
+			for k := i; k < j; k++ {
+				oldNum++
+				newNum++
+				if k-i < keepHead || j-k <= keepTail || j-i <= keepHead+keepTail {
+					rows = append(rows, SideBySideRow{
+						Kind:  "same",
+						Left:  &SideBySideLine{Num: oldNum, Text: ops[k].Text},
+						Right: &SideBySideLine{Num: newNum, Text: ops[k].Text},
+					})
+				} else if k-i == keepHead {
+					rows = append(rows, SideBySideRow{Kind: "skip", Count: j - i - keepHead - keepTail})
+				}
+			}
+			i = j
+			continue
+		}
+
+		var removed, added []string
+		for i < len(ops) && ops[i].Kind != '=' {
+			if ops[i].Kind == '-' {
+				removed = append(removed, ops[i].Text)
+			} else {
+				added = append(added, ops[i].Text)
+			}
+			i++
+		}
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			row := SideBySideRow{Kind: "change"}
+			if k < len(removed) {
+				oldNum++
+				row.Left = &SideBySideLine{Num: oldNum, Text: removed[k]}
+			} else {
+				row.Kind = "add"
+			}
+			if k < len(added) {
+				newNum++
+				row.Right = &SideBySideLine{Num: newNum, Text: added[k]}
+			} else {
+				row.Kind = "del"
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func compareFiles(left, right *compareSide, leftInfo, rightInfo os.FileInfo, format string) (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"type":      "file",
+		"left":      left.label + ":" + left.Path,
+		"right":     right.label + ":" + right.Path,
+		"leftSize":  leftInfo.Size(),
+		"rightSize": rightInfo.Size(),
+	}
+
+	if leftInfo.Size() > maxEditSize || rightInfo.Size() > maxEditSize {
+		identical, err := sameContent(left, right, left.Path, right.Path)
+		if err != nil {
+			return nil, err
+		}
+		result["identical"] = identical
+		result["reason"] = "large"
+		return result, nil
+	}
+
+	leftContent, err := left.readFile(left.Path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture de %s: %v", left.Path, err)
+	}
+	rightContent, err := right.readFile(right.Path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture de %s: %v", right.Path, err)
+	}
+
+	result["identical"] = contentVersion(leftContent) == contentVersion(rightContent)
+	if isBinary(leftContent) || isBinary(rightContent) {
+		result["reason"] = "binary"
+		return result, nil
+	}
+
+	leftText, _ := decodeText(leftContent)
+	rightText, _ := decodeText(rightContent)
+	result["diff"] = diffTexts(result["left"].(string), result["right"].(string), leftText, rightText)
+	if format == "side" {
+		result["rows"] = sideBySide(diffLines(splitLines(leftText), splitLines(rightText)), diffContext)
+	}
+	return result, nil
+}
+
+func sameContent(left, right *compareSide, leftPath, rightPath string) (bool, error) {
+	leftHash, err := left.hashFile(leftPath)
+	if err != nil {
+		return false, err
+	}
+	rightHash, err := right.hashFile(rightPath)
+	if err != nil {
+		return false, err
+	}
+	return leftHash == rightHash, nil
+}
+
+func compareDirs(left, right *compareSide) *DirComparison {
+	leftEntries, leftTruncated := left.walk()
+	rightEntries, rightTruncated := right.walk()
+
+	result := &DirComparison{
+		Type:      "dir",
+		Left:      left.label + ":" + left.Path,
+		Right:     right.label + ":" + right.Path,
+		OnlyLeft:  []CompareEntry{},
+		OnlyRight: []CompareEntry{},
+		Differing: []CompareEntry{},
+		Identical: []CompareEntry{},
+		Truncated: leftTruncated || rightTruncated,
+	}
+
+	// Entries inside a directory that exists on one side only are covered
+	// by that directory and not listed again.
+	coveredBy := func(rel string, other map[string]os.FileInfo) bool {
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if _, ok := other[dir]; !ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var names []string
+	for rel := range leftEntries {
+		names = append(names, rel)
+	}
+	for rel := range rightEntries {
+		if _, ok := leftEntries[rel]; !ok {
+			names = append(names, rel)
+		}
+	}
+	sort.Strings(names)
+
+	for _, rel := range names {
+		l, inLeft := leftEntries[rel]
+		r, inRight := rightEntries[rel]
+		switch {
+		case !inRight:
+			if !coveredBy(rel, rightEntries) {
+				result.OnlyLeft = append(result.OnlyLeft, CompareEntry{Path: rel, IsDir: l.IsDir(), LeftSize: l.Size()})
+			}
+			continue
+		case !inLeft:
+			if !coveredBy(rel, leftEntries) {
+				result.OnlyRight = append(result.OnlyRight, CompareEntry{Path: rel, IsDir: r.IsDir(), RightSize: r.Size()})
+			}
+			continue
+		}
+
+		entry := CompareEntry{Path: rel, IsDir: l.IsDir(), LeftSize: l.Size(), RightSize: r.Size()}
+		switch {
+		case l.IsDir() != r.IsDir():
+			entry.Reason = "type"
+		case l.IsDir():
+			continue
+		case l.Mode()&os.ModeSymlink != 0 || r.Mode()&os.ModeSymlink != 0:
+			leftTarget, _ := left.client.ReadLink(path.Join(left.Path, rel))
+			rightTarget, _ := right.client.ReadLink(path.Join(right.Path, rel))
+			if leftTarget != rightTarget || l.Mode().Type() != r.Mode().Type() {
+				entry.Reason = "link"
+			}
+		case !l.Mode().IsRegular() || !r.Mode().IsRegular():
+			if l.Mode().Type() != r.Mode().Type() {
+				entry.Reason = "type"
+			}
+		case l.Size() != r.Size():
+			entry.Reason = "size"
+		default:
+			same, err := sameContent(left, right, path.Join(left.Path, rel), path.Join(right.Path, rel))
+			if err != nil {
+				entry.Reason = "error: " + err.Error()
+			} else if !same {
+				entry.Reason = "content"
+			}
+		}
+
+		if entry.Reason == "" {
+			result.Identical = append(result.Identical, entry)
+		} else {
+			result.Differing = append(result.Differing, entry)
+		}
+	}
+	return result
+}
+
+func handleCompare(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Left   compareSide `json:"left"`
+		Right  compareSide `json:"right"`
+		Format string      `json:"format"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	left, right := &req.Left, &req.Right
+	if err := left.open(); err != nil {
+		sendError(w, fmt.Sprintf("Gauche: %v", err))
+		return
+	}
+	defer left.close()
+	if err := right.open(); err != nil {
+		sendError(w, fmt.Sprintf("Droite: %v", err))
+		return
+	}
+	defer right.close()
+
+	leftInfo, err := left.client.Stat(left.Path)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Gauche: %v", err))
+		return
+	}
+	rightInfo, err := right.client.Stat(right.Path)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Droite: %v", err))
+		return
+	}
+
+	switch {
+	case leftInfo.IsDir() && rightInfo.IsDir():
+		sendSuccess(w, "", compareDirs(left, right))
+	case leftInfo.IsDir() || rightInfo.IsDir():
+		sendError(w, "Impossible de comparer un fichier avec un dossier")
+	default:
+		result, err := compareFiles(left, right, leftInfo, rightInfo, req.Format)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur: %v", err))
+			return
+		}
+		sendSuccess(w, "", result)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+func handleCopy(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	src := cleanRemotePath(req.Source)
+	if src == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	if _, err := server.sftpClient.Lstat(src); err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	var dst string
+	if req.Destination == "" {
+		var err error
+		dst, err = duplicateName(src)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur: %v", err))
+			return
+		}
+	} else {
+		dst = cleanRemotePath(req.Destination)
+		if _, err := server.sftpClient.Lstat(dst); err == nil {
+			sendError(w, fmt.Sprintf("%s existe déjà", dst))
+			return
+		}
+	}
+
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		sendError(w, "Impossible de copier un dossier dans lui-même")
+		return
+	}
+
+	method, err := copyRemote(src, dst)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur de copie: %v", err))
+		return
+	}
+
+	sendSuccess(w, "Copié avec succès", map[string]interface{}{
+		"path":   dst,
+		"method": method,
+	})
+}
+
+func cleanRemotePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	return path.Clean(filepath.ToSlash(p))
+}
+
+func duplicateName(src string) (string, error) {
+	dir, name := path.Split(src)
+	ext := path.Ext(name)
+	if ext == name {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 1; i < 1000; i++ {
+		suffix := " copie"
+		if i > 1 {
+			suffix = fmt.Sprintf(" copie %d", i)
+		}
+		candidate := path.Join(dir, base+suffix+ext)
+		if _, err := server.sftpClient.Lstat(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("aucun nom disponible pour %s", name)
+}
+
+func copyRemote(src, dst string) (string, error) {
+	output, err := runRemoteCommand(fmt.Sprintf("cp -a -- %s %s", shellQuote(src), shellQuote(dst)))
+	if err == nil {
+		return "cp", nil
+	}
+	if server.useSudo || !isCommandUnavailable(err) {
+		return "", commandError(output, err)
+	}
+
+	if err := copyWithSFTP(src, dst); err != nil {
+		return "", err
+	}
+	return "sftp", nil
+}
+
+func copyWithSFTP(src, dst string) error {
+	info, err := server.sftpClient.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := server.sftpClient.ReadLink(src)
+		if err != nil {
+			return err
+		}
+		return server.sftpClient.Symlink(target, dst)
+
+	case info.IsDir():
+		if err := server.sftpClient.Mkdir(dst); err != nil {
+			return err
+		}
+		entries, err := server.sftpClient.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyWithSFTP(path.Join(src, entry.Name()), path.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+
+	default:
+		if err := copyFileWithSFTP(src, dst); err != nil {
+			return err
+		}
+	}
+
+	return preserveAttributes(dst, info)
+}
+
+func copyFileWithSFTP(src, dst string) error {
+	in, err := server.sftpClient.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := server.sftpClient.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func preserveAttributes(dst string, info os.FileInfo) error {
+	if err := server.sftpClient.Chmod(dst, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+
+	atime := info.ModTime()
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		atime = time.Unix(int64(stat.Atime), 0)
+	}
+	return server.sftpClient.Chtimes(dst, atime, info.ModTime())
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const deletePreviewLimit = 200
+
+var protectedPaths = []string{
+	"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64",
+	"/opt", "/proc", "/root", "/sbin", "/srv", "/sys", "/usr", "/var",
+}
+
+type DeleteEntry struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+	Size  int64  `json:"size"`
+}
+
+type DeletePreview struct {
+	Path      string        `json:"path"`
+	Files     int           `json:"files"`
+	Dirs      int           `json:"dirs"`
+	Size      int64         `json:"size"`
+	Entries   []DeleteEntry `json:"entries"`
+	Truncated bool          `json:"truncated"`
+}
+
+func (p *DeletePreview) add(entry DeleteEntry) {
+	if entry.IsDir {
+		p.Dirs++
+	} else {
+		p.Files++
+		p.Size += entry.Size
+	}
+	if len(p.Entries) < deletePreviewLimit {
+		p.Entries = append(p.Entries, entry)
+	} else {
+		p.Truncated = true
+	}
+}
+
+func parsePathList(list string) []string {
+	var paths []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			paths = append(paths, path.Clean(p))
+		}
+	}
+	return paths
+}
+
+// isProtectedPath reports whether deleting p would remove a protected path,
+// either the path itself or one of its ancestors.
+func isProtectedPath(p string) bool {
+	candidates := []string{path.Clean(p)}
+	if real, err := server.sftpClient.RealPath(p); err == nil {
+		candidates = append(candidates, path.Clean(real))
+	}
+
+	for _, candidate := range candidates {
+		prefix := strings.TrimSuffix(candidate, "/") + "/"
+		for _, protected := range protectedPaths {
+			if candidate == protected || strings.HasPrefix(protected, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func handleDeletePreview(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	p := cleanRemotePath(r.URL.Query().Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	if isProtectedPath(p) {
+		sendError(w, fmt.Sprintf("%s est protégé et ne peut pas être supprimé", p))
+		return
+	}
+
+	var preview *DeletePreview
+	var err error
+	if server.useSudo {
+		preview, err = previewWithFind(p)
+	}
+	if preview == nil {
+		preview, err = previewWithSFTP(p)
+	}
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	sendSuccess(w, "", preview)
+}
+
+func previewWithSFTP(root string) (*DeletePreview, error) {
+	preview := &DeletePreview{Path: root}
+	walker := server.sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, err
+		}
+		info := walker.Stat()
+		preview.add(DeleteEntry{
+			Path:  walker.Path(),
+			IsDir: info.IsDir(),
+			Size:  info.Size(),
+		})
+	}
+	return preview, nil
+}
+
+func previewWithFind(root string) (*DeletePreview, error) {
+	output, err := runRemoteCommand(fmt.Sprintf("find %s -printf '%%y\\t%%s\\t%%p\\n'", shellQuote(root)))
+	if err != nil {
+		return nil, commandError(output, err)
+	}
+
+	preview := &DeletePreview{Path: root}
+	for _, line := range strings.Split(strings.TrimRight(string(output), "\n"), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		preview.add(DeleteEntry{
+			Path:  fields[2],
+			IsDir: fields[0] == "d",
+			Size:  size,
+		})
+	}
+	return preview, nil
+}
+
+func removeAllWithSFTP(p string) error {
+	info, err := server.sftpClient.Lstat(p)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 && info.IsDir() {
+		entries, err := server.sftpClient.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := removeAllWithSFTP(path.Join(p, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return server.sftpClient.RemoveDirectory(p)
+	}
+
+	return server.sftpClient.Remove(p)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext  = 3
+	maxDiffEdits = 4000
+)
+
+type DiffOp struct {
+	Kind byte   `json:"kind"`
+	Text string `json:"text"`
+}
+
+type DiffHunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+type FileDiff struct {
+	Unified string     `json:"unified"`
+	Hunks   []DiffHunk `json:"hunks"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a minimal line diff with Myers' algorithm. Common
+// prefix and suffix are trimmed first; if the remaining edit distance is
+// too large, the middle is reported as a single replacement.
+func diffLines(a, b []string) []DiffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]DiffOp, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		ops = append(ops, DiffOp{Kind: '=', Text: line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, DiffOp{Kind: '=', Text: line})
+	}
+	return ops
+}
+
+func replaceOps(a, b []string) []DiffOp {
+	ops := make([]DiffOp, 0, len(a)+len(b))
+	for _, line := range a {
+		ops = append(ops, DiffOp{Kind: '-', Text: line})
+	}
+	for _, line := range b {
+		ops = append(ops, DiffOp{Kind: '+', Text: line})
+	}
+	return ops
+}
+
+func myers(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceOps(a, b)
+	}
+
+	// Compare interned line IDs rather than strings.
+	ids := map[string]int{}
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	ai, bi := intern(a), intern(b)
+
+	limit := n + m
+	offset := limit
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		if d > maxDiffEdits {
+			return replaceOps(a, b)
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && ai[x] == bi[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrackMyers(trace, a, b)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	return replaceOps(a, b)
+}
+
+func backtrackMyers(trace [][]int, a, b []string) []DiffOp {
+	x, y := len(a), len(b)
+	var ops []DiffOp
+
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, DiffOp{Kind: '=', Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, DiffOp{Kind: '+', Text: b[y-1]})
+			y--
+		} else {
+			ops = append(ops, DiffOp{Kind: '-', Text: a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, DiffOp{Kind: '=', Text: a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func buildHunks(ops []DiffOp, context int) []DiffHunk {
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.Kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.Kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var hunks []DiffHunk
+	prevEnd := 0
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].Kind == '=' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := max(i-context, prevEnd)
+
+		j := i
+		for j < len(ops) {
+			if ops[j].Kind != '=' {
+				j++
+				continue
+			}
+			run := j
+			for run < len(ops) && ops[run].Kind == '=' {
+				run++
+			}
+			if run == len(ops) || run-j > 2*context {
+				break
+			}
+			j = run
+		}
+		end := min(j+context, len(ops))
+
+		hunk := DiffHunk{
+			OldStart: oldLine[start] + 1,
+			OldLines: oldLine[end] - oldLine[start],
+			NewStart: newLine[start] + 1,
+			NewLines: newLine[end] - newLine[start],
+		}
+		if hunk.OldLines == 0 {
+			hunk.OldStart--
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart--
+		}
+		for _, op := range ops[start:end] {
+			prefix := " "
+			if op.Kind != '=' {
+				prefix = string(op.Kind)
+			}
+			hunk.Lines = append(hunk.Lines, prefix+op.Text)
+		}
+		hunks = append(hunks, hunk)
+		prevEnd = end
+		i = end
+	}
+	return hunks
+}
+
+const noNewlineMarker = "\\ No newline at end of file"
+
+// diffLinesMarkingEOF splits text into lines, tagging the last one when the
+// text does not end with a newline so that adding or removing the final
+// newline shows up as a change.
+func diffLinesMarkingEOF(text string) []string {
+	lines := splitLines(text)
+	if len(lines) > 0 && !strings.HasSuffix(text, "\n") {
+		lines[len(lines)-1] += "\n" + noNewlineMarker
+	}
+	return lines
+}
+
+func diffTexts(oldName, newName, oldText, newText string) *FileDiff {
+	ops := diffLines(diffLinesMarkingEOF(oldText), diffLinesMarkingEOF(newText))
+
+	result := &FileDiff{Hunks: buildHunks(ops, diffContext)}
+	for i, hunk := range result.Hunks {
+		var lines []string
+		for _, line := range hunk.Lines {
+			lines = append(lines, strings.Split(line, "\n")...)
+		}
+		result.Hunks[i].Lines = lines
+	}
+	for _, op := range ops {
+		switch op.Kind {
+		case '+':
+			result.Added++
+		case '-':
+			result.Removed++
+		}
+	}
+
+	if len(result.Hunks) > 0 {
+		var out strings.Builder
+		fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		for _, hunk := range result.Hunks {
+			fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+			for _, line := range hunk.Lines {
+				out.WriteString(line)
+				out.WriteByte('\n')
+			}
+		}
+		result.Unified = out.String()
+	}
+	return result
+}
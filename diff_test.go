@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func formatOps(ops []DiffOp) string {
+	var parts []string
+	for _, op := range ops {
+		parts = append(parts, string(op.Kind)+op.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"identical", "a\nb\nc", "a\nb\nc", "=a =b =c"},
+		{"both empty", "", "", ""},
+		{"from empty", "", "a\nb", "+a +b"},
+		{"to empty", "a\nb", "", "-a -b"},
+		{"insert in middle", "a\nc", "a\nb\nc", "=a +b =c"},
+		{"delete in middle", "a\nb\nc", "a\nc", "=a -b =c"},
+		{"replace line", "a\nb\nc", "a\nx\nc", "=a -b +x =c"},
+		{"append", "a\nb", "a\nb\nc", "=a =b +c"},
+		{"prepend", "b\nc", "a\nb\nc", "+a =b =c"},
+		{"moved line", "a\nb\nc\nd", "b\nc\na\nd", "-a =b =c +a =d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatOps(diffLines(splitLines(tt.a), splitLines(tt.b)))
+			if got != tt.want {
+				t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesRebuildsBothSides(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc"},
+		{"x\ny\nz", "y\nz\nx\ny"},
+		{"1\n2\n3\n4\n5", "1\n3\n5\n6"},
+	}
+
+	for _, tt := range tests {
+		a, b := splitLines(tt.a), splitLines(tt.b)
+		var gotA, gotB []string
+		for _, op := range diffLines(a, b) {
+			if op.Kind != '+' {
+				gotA = append(gotA, op.Text)
+			}
+			if op.Kind != '-' {
+				gotB = append(gotB, op.Text)
+			}
+		}
+		if strings.Join(gotA, "\n") != tt.a || strings.Join(gotB, "\n") != tt.b {
+			t.Errorf("diffLines(%q, %q) rebuilds %q and %q", tt.a, tt.b, gotA, gotB)
+		}
+	}
+}
+
+func TestDiffTextsTrailingNewline(t *testing.T) {
+	tests := []struct {
+		name, old, new string
+		want           string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", ""},
+		{"unchanged without newline", "a\nb", "a\nb", ""},
+		{
+			"newline added", "a\nb", "a\nb\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n" + noNewlineMarker + "\n+b\n",
+		},
+		{
+			"newline removed", "a\nb\n", "a\nb",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n" + noNewlineMarker + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffTexts("old", "new", tt.old, tt.new).Unified; got != tt.want {
+				t.Errorf("diffTexts(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
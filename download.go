@@ -0,0 +1,213 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+func handleDownload(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	p := cleanRemotePath(r.URL.Query().Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	info, err := server.sftpClient.Stat(p)
+	if err != nil && !server.useSudo {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	if info == nil || !info.IsDir() {
+		downloadFile(w, p, info)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "zip":
+		// The SFTP walk cannot read root-only files, so sudo mode needs zip
+		// on the server.
+		if server.useSudo {
+			if !remoteCommandExists("zip") {
+				sendError(w, "zip n'est pas installé sur le serveur, utilisez tar.gz")
+				return
+			}
+			setAttachment(w, path.Base(p)+".zip", "application/zip")
+			err = streamRemoteCommand(fmt.Sprintf("cd %s && zip -qr - %s",
+				shellQuote(path.Dir(p)), shellQuote("./"+path.Base(p))), w)
+			break
+		}
+		setAttachment(w, path.Base(p)+".zip", "application/zip")
+		err = writeZipWithSFTP(w, p)
+	case "tar.gz":
+		setAttachment(w, path.Base(p)+".tar.gz", "application/gzip")
+		if remoteCommandExists("tar") {
+			err = streamRemoteCommand(fmt.Sprintf("tar -czf - -C %s -- %s",
+				shellQuote(path.Dir(p)), shellQuote(path.Base(p))), w)
+		} else {
+			err = writeTarGzWithSFTP(w, p)
+		}
+	default:
+		sendError(w, fmt.Sprintf("Format inconnu: %s", format))
+		return
+	}
+
+	if err != nil {
+		log.Printf("téléchargement de %s interrompu: %v", p, err)
+	}
+}
+
+func setAttachment(w http.ResponseWriter, name, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+func downloadFile(w http.ResponseWriter, p string, info os.FileInfo) {
+	if server.useSudo {
+		setAttachment(w, path.Base(p), "application/octet-stream")
+		if err := streamRemoteCommand("cat -- "+shellQuote(p), w); err != nil {
+			log.Printf("téléchargement de %s interrompu: %v", p, err)
+		}
+		return
+	}
+
+	file, err := server.sftpClient.Open(p)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Impossible d'ouvrir: %v", err))
+		return
+	}
+	defer file.Close()
+
+	setAttachment(w, path.Base(p), "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if _, err := io.Copy(w, file); err != nil {
+		log.Printf("téléchargement de %s interrompu: %v", p, err)
+	}
+}
+
+func archiveName(root, p string) string {
+	base := path.Base(root)
+	if base == "/" {
+		base = "root"
+	}
+	return path.Join(base, strings.TrimPrefix(strings.TrimPrefix(p, root), "/"))
+}
+
+func writeZipWithSFTP(w io.Writer, root string) error {
+	archive := zip.NewWriter(w)
+
+	walker := server.sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		info := walker.Stat()
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = archiveName(root, walker.Path())
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		entry, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := server.sftpClient.ReadLink(walker.Path())
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(entry, target); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := copyRemoteFile(entry, walker.Path()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeTarGzWithSFTP(w io.Writer, root string) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	walker := server.sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		info := walker.Stat()
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := server.sftpClient.ReadLink(walker.Path())
+			if err != nil {
+				return err
+			}
+			link = target
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = archiveName(root, walker.Path())
+		if stat, ok := info.Sys().(*sftp.FileStat); ok {
+			header.Uid = int(stat.UID)
+			header.Gid = int(stat.GID)
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			if err := copyRemoteFile(archive, walker.Path()); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func copyRemoteFile(w io.Writer, p string) error {
+	file, err := server.sftpClient.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
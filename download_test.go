@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestArchiveName(t *testing.T) {
+	tests := []struct {
+		root, p, want string
+	}{
+		{"/srv/www", "/srv/www", "www"},
+		{"/srv/www", "/srv/www/index.html", "www/index.html"},
+		{"/srv/www", "/srv/www/css/site.css", "www/css/site.css"},
+		{"/srv/www/", "/srv/www/index.html", "www/index.html"},
+		{"/", "/", "root"},
+		{"/", "/etc/hosts", "root/etc/hosts"},
+	}
+
+	for _, tt := range tests {
+		if got := archiveName(tt.root, tt.p); got != tt.want {
+			t.Errorf("archiveName(%q, %q) = %q, want %q", tt.root, tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type TextFormat struct {
+	Encoding string `json:"encoding"`
+	BOM      bool   `json:"bom"`
+	EOL      string `json:"eol"`
+	MixedEOL bool   `json:"mixedEol,omitempty"`
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+var eolSequences = map[string]string{
+	"lf":   "\n",
+	"crlf": "\r\n",
+	"cr":   "\r",
+}
+
+// decodeText converts raw file bytes to UTF-8 with "\n" line endings and
+// reports the format needed to write them back unchanged.
+func decodeText(raw []byte) (string, TextFormat) {
+	var format TextFormat
+	var text string
+
+	switch {
+	case bytes.HasPrefix(raw, bomUTF8):
+		format = TextFormat{Encoding: "utf-8", BOM: true}
+		text = string(raw[len(bomUTF8):])
+	case bytes.HasPrefix(raw, bomUTF16LE):
+		format = TextFormat{Encoding: "utf-16le", BOM: true}
+		text = decodeUTF16(raw[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(raw, bomUTF16BE):
+		format = TextFormat{Encoding: "utf-16be", BOM: true}
+		text = decodeUTF16(raw[len(bomUTF16BE):], binary.BigEndian)
+	case utf8.Valid(raw):
+		format = TextFormat{Encoding: "utf-8"}
+		text = string(raw)
+	default:
+		format = TextFormat{Encoding: "iso-8859-1"}
+		for _, b := range raw {
+			if b >= 0x80 && b <= 0x9F {
+				format.Encoding = "windows-1252"
+				break
+			}
+		}
+		text = decodeSingleByte(raw, format.Encoding)
+	}
+
+	crlf := strings.Count(text, "\r\n")
+	cr := strings.Count(text, "\r") - crlf
+	lf := strings.Count(text, "\n") - crlf
+
+	format.EOL = "lf"
+	if crlf > lf && crlf >= cr {
+		format.EOL = "crlf"
+	} else if cr > lf && cr > crlf {
+		format.EOL = "cr"
+	}
+	kinds := 0
+	for _, n := range []int{crlf, cr, lf} {
+		if n > 0 {
+			kinds++
+		}
+	}
+	format.MixedEOL = kinds > 1
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return text, format
+}
+
+func encodeText(text string, format TextFormat) ([]byte, error) {
+	eol, ok := eolSequences[format.EOL]
+	if !ok {
+		eol = "\n"
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if eol != "\n" {
+		text = strings.ReplaceAll(text, "\n", eol)
+	}
+
+	var out []byte
+	switch format.Encoding {
+	case "", "utf-8":
+		if format.BOM {
+			out = append(out, bomUTF8...)
+		}
+		out = append(out, text...)
+	case "utf-16le", "utf-16be":
+		var order binary.AppendByteOrder = binary.LittleEndian
+		bom := bomUTF16LE
+		if format.Encoding == "utf-16be" {
+			order, bom = binary.BigEndian, bomUTF16BE
+		}
+		if format.BOM {
+			out = append(out, bom...)
+		}
+		for _, unit := range utf16.Encode([]rune(text)) {
+			out = order.AppendUint16(out, unit)
+		}
+	case "iso-8859-1", "windows-1252":
+		encoded, err := encodeSingleByte(text, format.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		out = encoded
+	default:
+		return nil, fmt.Errorf("encodage non supporté: %s", format.Encoding)
+	}
+	return out, nil
+}
+
+func decodeUTF16(raw []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = order.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeSingleByte(raw []byte, encoding string) string {
+	var out strings.Builder
+	out.Grow(len(raw))
+	for _, b := range raw {
+		if encoding == "windows-1252" && b >= 0x80 && b <= 0x9F {
+			out.WriteRune(windows1252[b-0x80])
+		} else {
+			out.WriteRune(rune(b))
+		}
+	}
+	return out.String()
+}
+
+func encodeSingleByte(text, encoding string) ([]byte, error) {
+	out := make([]byte, 0, len(text))
+	line := 1
+	for _, r := range text {
+		if r == '\n' {
+			line++
+		}
+		if b, ok := singleByte(r, encoding); ok {
+			out = append(out, b)
+			continue
+		}
+		return nil, fmt.Errorf("le caractère %q (ligne %d) n'existe pas en %s", r, line, encoding)
+	}
+	return out, nil
+}
+
+func singleByte(r rune, encoding string) (byte, bool) {
+	if encoding == "windows-1252" {
+		for i, mapped := range windows1252 {
+			if mapped == r {
+				return byte(0x80 + i), true
+			}
+		}
+		if r >= 0x80 && r <= 0x9F {
+			return 0, false
+		}
+	}
+	if r < 0x100 {
+		return byte(r), true
+	}
+	return 0, false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    []byte
+		want   string
+		format TextFormat
+	}{
+		{"utf-8", []byte("été\n"), "été\n", TextFormat{Encoding: "utf-8", EOL: "lf"}},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFa\n"), "a\n", TextFormat{Encoding: "utf-8", BOM: true, EOL: "lf"}},
+		{"empty", nil, "", TextFormat{Encoding: "utf-8", EOL: "lf"}},
+		{"crlf", []byte("a\r\nb\r\n"), "a\nb\n", TextFormat{Encoding: "utf-8", EOL: "crlf"}},
+		{"cr", []byte("a\rb\r"), "a\nb\n", TextFormat{Encoding: "utf-8", EOL: "cr"}},
+		{"mixed", []byte("a\r\nb\r\nc\n"), "a\nb\nc\n", TextFormat{Encoding: "utf-8", EOL: "crlf", MixedEOL: true}},
+		{"utf-16le", []byte{0xFF, 0xFE, 'h', 0, 'i', 0, '\r', 0, '\n', 0}, "hi\n", TextFormat{Encoding: "utf-16le", BOM: true, EOL: "crlf"}},
+		{"utf-16be", []byte{0xFE, 0xFF, 0, 'h', 0xD8, 0x3D, 0xDE, 0x00}, "h😀", TextFormat{Encoding: "utf-16be", BOM: true, EOL: "lf"}},
+		{"iso-8859-1", []byte("caf\xE9\n"), "café\n", TextFormat{Encoding: "iso-8859-1", EOL: "lf"}},
+		{"windows-1252", []byte("\x80 \xE9\n"), "€ é\n", TextFormat{Encoding: "windows-1252", EOL: "lf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, format := decodeText(tt.raw)
+			if got != tt.want || format != tt.format {
+				t.Errorf("decodeText(%q) = %q, %+v; want %q, %+v", tt.raw, got, format, tt.want, tt.format)
+			}
+		})
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		format  TextFormat
+		want    []byte
+		wantErr bool
+	}{
+		{"utf-8", "été\n", TextFormat{Encoding: "utf-8", EOL: "lf"}, []byte("été\n"), false},
+		{"default format", "a\n", TextFormat{}, []byte("a\n"), false},
+		{"utf-8 bom crlf", "a\nb", TextFormat{Encoding: "utf-8", BOM: true, EOL: "crlf"}, []byte("\xEF\xBB\xBFa\r\nb"), false},
+		{"cr", "a\nb\n", TextFormat{Encoding: "utf-8", EOL: "cr"}, []byte("a\rb\r"), false},
+		{"crlf input kept single", "a\r\nb", TextFormat{Encoding: "utf-8", EOL: "crlf"}, []byte("a\r\nb"), false},
+		{"utf-16le", "hi\n", TextFormat{Encoding: "utf-16le", BOM: true, EOL: "crlf"}, []byte{0xFF, 0xFE, 'h', 0, 'i', 0, '\r', 0, '\n', 0}, false},
+		{"utf-16be", "h😀", TextFormat{Encoding: "utf-16be", BOM: true, EOL: "lf"}, []byte{0xFE, 0xFF, 0, 'h', 0xD8, 0x3D, 0xDE, 0x00}, false},
+		{"iso-8859-1", "café", TextFormat{Encoding: "iso-8859-1", EOL: "lf"}, []byte("caf\xE9"), false},
+		{"windows-1252", "€ é", TextFormat{Encoding: "windows-1252", EOL: "lf"}, []byte("\x80 \xE9"), false},
+		{"not representable", "€", TextFormat{Encoding: "iso-8859-1", EOL: "lf"}, nil, true},
+		{"unknown encoding", "a", TextFormat{Encoding: "ebcdic", EOL: "lf"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeText(tt.text, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("encodeText(%q, %+v) error = %v, wantErr %v", tt.text, tt.format, err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("encodeText(%q, %+v) = %q, want %q", tt.text, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	inputs := [][]byte{
+		[]byte("plain\nascii\n"),
+		[]byte("\xEF\xBB\xBFbom\r\nand crlf\r\n"),
+		[]byte("caf\xE9\rcr\r"),
+		[]byte("\x93quoted\x94\r\n"),
+		{0xFF, 0xFE, 'a', 0, '\n', 0},
+	}
+
+	for _, raw := range inputs {
+		text, format := decodeText(raw)
+		got, err := encodeText(text, format)
+		if err != nil {
+			t.Errorf("encodeText(decodeText(%q)) error: %v", raw, err)
+			continue
+		}
+		if !bytes.Equal(got, raw) {
+			t.Errorf("round trip of %q gave %q", raw, got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	binarySampleSize = 8000
+	hexRowSize       = 16
+	hexPageSize      = 4096
+	maxHexPageSize   = 64 * 1024
+)
+
+var textBOMs = [][]byte{
+	{0xEF, 0xBB, 0xBF},
+	{0xFF, 0xFE},
+	{0xFE, 0xFF},
+}
+
+type HexPage struct {
+	Path       string   `json:"path"`
+	Size       int64    `json:"size"`
+	Offset     int64    `json:"offset"`
+	NextOffset int64    `json:"nextOffset"`
+	Lines      []string `json:"lines"`
+	EOF        bool     `json:"eof"`
+}
+
+func isBinary(content []byte) bool {
+	sample := content
+	if len(sample) > binarySampleSize {
+		sample = sample[:binarySampleSize]
+	}
+	if len(sample) == 0 {
+		return false
+	}
+
+	for _, bom := range textBOMs {
+		if bytes.HasPrefix(sample, bom) {
+			return false
+		}
+	}
+
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return true
+	}
+
+	control, invalid := 0, 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && size <= 1 {
+			if len(sample)-i < utf8.UTFMax && !utf8.FullRune(sample[i:]) {
+				break
+			}
+			invalid++
+		} else if isControlRune(r) {
+			control++
+		}
+		i += max(size, 1)
+	}
+
+	return control*10 > len(sample) || (control+invalid)*10 > len(sample)*3
+}
+
+func isControlRune(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r', '\f', '\b', 0x1b:
+		return false
+	}
+	return r < 0x20 || r == 0x7f
+}
+
+func handleFileHex(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	query := r.URL.Query()
+	p := cleanRemotePath(query.Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	size, err := remoteSize(p)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	offset, _ := strconv.ParseInt(query.Get("offset"), 10, 64)
+	length, _ := strconv.ParseInt(query.Get("length"), 10, 64)
+	if offset < 0 {
+		offset = 0
+	}
+	offset -= offset % hexRowSize
+	if length <= 0 {
+		length = hexPageSize
+	}
+	if length > maxHexPageSize {
+		length = maxHexPageSize
+	}
+
+	data, err := readRange(p, offset, length)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur de lecture: %v", err))
+		return
+	}
+
+	sendSuccess(w, "", &HexPage{
+		Path:       p,
+		Size:       size,
+		Offset:     offset,
+		NextOffset: offset + int64(len(data)),
+		Lines:      hexDump(data, offset),
+		EOF:        offset+int64(len(data)) >= size,
+	})
+}
+
+func hexDump(data []byte, offset int64) []string {
+	lines := make([]string, 0, (len(data)+hexRowSize-1)/hexRowSize)
+	for start := 0; start < len(data); start += hexRowSize {
+		row := data[start:min(start+hexRowSize, len(data))]
+
+		var line strings.Builder
+		fmt.Fprintf(&line, "%08x  ", offset+int64(start))
+		for i := 0; i < hexRowSize; i++ {
+			if i < len(row) {
+				fmt.Fprintf(&line, "%02x ", row[i])
+			} else {
+				line.WriteString("   ")
+			}
+			if i == hexRowSize/2-1 {
+				line.WriteByte(' ')
+			}
+		}
+
+		line.WriteString(" |")
+		for _, b := range row {
+			if b >= 0x20 && b < 0x7f {
+				line.WriteByte(b)
+			} else {
+				line.WriteByte('.')
+			}
+		}
+		line.WriteByte('|')
+		lines = append(lines, line.String())
+	}
+	return lines
+}
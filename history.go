@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var historyDir = defaultHistoryDir()
+
+// Retention limits: versions kept per file, and total size of the stored
+// contents across all files. The oldest versions go first.
+var (
+	historyMaxVersions       = 50
+	historyMaxBytes    int64 = 200 << 20
+)
+
+type HistoryVersion struct {
+	ID      string    `json:"id"`
+	Host    string    `json:"host"`
+	Path    string    `json:"path"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Size    int       `json:"size"`
+	Version string    `json:"version"`
+	Note    string    `json:"note,omitempty"`
+}
+
+func defaultHistoryDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ssh-editor-history")
+	}
+	return filepath.Join(home, ".ssh-editor", "history")
+}
+
+func webUser(r *http.Request) string {
+	if user := r.Header.Get("X-Forwarded-User"); user != "" {
+		return user
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func historyKeyDir(host, p string) string {
+	sum := sha256.Sum256([]byte(host + "\x00" + p))
+	return filepath.Join(historyDir, hex.EncodeToString(sum[:12]))
+}
+
+func validHistoryID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+func recordHistory(p string, content []byte, user, note string) error {
+	dir := historyKeyDir(server.host, p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	version := contentVersion(content)
+	if versions, err := listHistory(p); err == nil && len(versions) > 0 && versions[0].Version == version {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	entry := HistoryVersion{
+		ID:      now.Format("20060102T150405") + fmt.Sprintf("%09d", now.Nanosecond()),
+		Host:    server.host,
+		Path:    p,
+		Time:    now,
+		User:    user,
+		Size:    len(content),
+		Version: version,
+		Note:    note,
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, entry.ID+".txt"), content, 0600); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, entry.ID+".json"), meta, 0600); err != nil {
+		return err
+	}
+	pruneHistory(p, entry.ID)
+	return nil
+}
+
+func removeHistoryVersion(dir, id string) {
+	os.Remove(filepath.Join(dir, id+".txt"))
+	os.Remove(filepath.Join(dir, id+".json"))
+}
+
+// pruneHistory drops the versions of p beyond historyMaxVersions, then the
+// oldest versions of any file while the store exceeds historyMaxBytes. The
+// version just recorded (keep) is never dropped.
+func pruneHistory(p, keep string) {
+	if versions, err := listHistory(p); err == nil && historyMaxVersions > 0 {
+		dir := historyKeyDir(server.host, p)
+		for _, version := range versions[min(len(versions), historyMaxVersions):] {
+			removeHistoryVersion(dir, version.ID)
+		}
+	}
+	if historyMaxBytes <= 0 {
+		return
+	}
+
+	type stored struct {
+		dir, id string
+		size    int64
+	}
+	var all []stored
+	var total int64
+	filepath.WalkDir(historyDir, func(file string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".txt") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		all = append(all, stored{filepath.Dir(file), strings.TrimSuffix(d.Name(), ".txt"), info.Size()})
+		total += info.Size()
+		return nil
+	})
+	if total <= historyMaxBytes {
+		return
+	}
+
+	// IDs are timestamps, so they sort by age across files.
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].id < all[j].id
+	})
+	for _, version := range all {
+		if total <= historyMaxBytes {
+			break
+		}
+		if version.id == keep {
+			continue
+		}
+		removeHistoryVersion(version.dir, version.id)
+		total -= version.size
+	}
+}
+
+func listHistory(p string) ([]HistoryVersion, error) {
+	dir := historyKeyDir(server.host, p)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []HistoryVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []HistoryVersion{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var version HistoryVersion
+		if json.Unmarshal(data, &version) == nil && version.Path == p && version.Host == server.host {
+			versions = append(versions, version)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+	return versions, nil
+}
+
+func readHistoryContent(p, id string) ([]byte, error) {
+	if !validHistoryID(id) {
+		return nil, fmt.Errorf("version invalide")
+	}
+	return os.ReadFile(filepath.Join(historyKeyDir(server.host, p), id+".txt"))
+}
+
+// historyContent resolves a version ID, or "current" for the remote file.
+func historyContent(p, id string) ([]byte, string, error) {
+	if id == "current" {
+		content, err := readRemoteFile(p)
+		return content, p + " (serveur)", err
+	}
+	content, err := readHistoryContent(p, id)
+	return content, p + " @ " + id, err
+}
+
+// recordSave keeps the content that was on the server before the first save
+// through the editor, then the newly saved content.
+func recordSave(p string, previous, saved []byte, user string) {
+	if previous != nil {
+		if versions, err := listHistory(p); err == nil && len(versions) == 0 {
+			if err := recordHistory(p, previous, user, "version initiale"); err != nil {
+				log.Printf("historique de %s: %v", p, err)
+			}
+		}
+	}
+	if err := recordHistory(p, saved, user, ""); err != nil {
+		log.Printf("historique de %s: %v", p, err)
+	}
+}
+
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	p := cleanRemotePath(r.URL.Query().Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	versions, err := listHistory(p)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+	sendSuccess(w, "", versions)
+}
+
+func handleHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	query := r.URL.Query()
+	p := cleanRemotePath(query.Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	from, fromName, err := historyContent(p, query.Get("from"))
+	if err != nil {
+		sendError(w, fmt.Sprintf("Version introuvable: %v", err))
+		return
+	}
+	to, toName, err := historyContent(p, query.Get("to"))
+	if err != nil {
+		sendError(w, fmt.Sprintf("Version introuvable: %v", err))
+		return
+	}
+
+	fromText, _ := decodeText(from)
+	toText, _ := decodeText(to)
+	sendSuccess(w, "", diffTexts(fromName, toName, fromText, toText))
+}
+
+func handleHistoryRestore(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		Path string `json:"path"`
+		ID   string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	req.Path = cleanRemotePath(req.Path)
+	if req.Path == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+	versions, err := listHistory(req.Path)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+	known := false
+	for _, version := range versions {
+		known = known || version.ID == req.ID
+	}
+	if !known {
+		sendError(w, "Version inconnue")
+		return
+	}
+
+	content, err := readHistoryContent(req.Path, req.ID)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Version introuvable: %v", err))
+		return
+	}
+
+	if err := writeRemoteFile(req.Path, content); err != nil {
+		sendError(w, fmt.Sprintf("Erreur d'écriture: %v", err))
+		return
+	}
+
+	if err := recordHistory(req.Path, content, webUser(r), "restauration de "+req.ID); err != nil {
+		log.Printf("historique de %s: %v", req.Path, err)
+	}
+
+	text, format := decodeText(content)
+	sendSuccess(w, "Version restaurée", map[string]interface{}{
+		"content": text,
+		"format":  format,
+		"version": contentVersion(content),
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRecordHistoryRetention(t *testing.T) {
+	savedDir, savedServer := historyDir, server
+	savedVersions, savedBytes := historyMaxVersions, historyMaxBytes
+	defer func() {
+		historyDir, server = savedDir, savedServer
+		historyMaxVersions, historyMaxBytes = savedVersions, savedBytes
+	}()
+	historyDir = t.TempDir()
+	server = &Server{host: "example"}
+
+	historyMaxVersions, historyMaxBytes = 3, 0
+	for i := 0; i < 5; i++ {
+		if err := recordHistory("/a.txt", []byte(fmt.Sprintf("v%d", i)), "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := listHistory("/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("kept %d versions, want 3", len(versions))
+	}
+	if content, _ := readHistoryContent("/a.txt", versions[0].ID); string(content) != "v4" {
+		t.Errorf("latest version = %q, want v4", content)
+	}
+
+	// The byte cap drops the oldest versions of any file, never the new one.
+	historyMaxVersions, historyMaxBytes = 0, 5
+	if err := recordHistory("/b.txt", []byte("0123456789"), "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := listHistory("/a.txt"); len(versions) != 0 {
+		t.Errorf("/a.txt kept %d versions over the byte cap, want 0", len(versions))
+	}
+	if versions, _ := listHistory("/b.txt"); len(versions) != 1 {
+		t.Errorf("/b.txt kept %d versions, want 1", len(versions))
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	conflictOurs   = "<<<<<<< éditeur"
+	conflictBase   = "||||||| base"
+	conflictSep    = "======="
+	conflictTheirs = ">>>>>>> serveur"
+)
+
+// mergeChange replaces base[start:end] with lines.
+type mergeChange struct {
+	start, end int
+	lines      []string
+}
+
+func changesFrom(ops []DiffOp) []mergeChange {
+	var changes []mergeChange
+	pos := 0
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == '=' {
+			pos++
+			i++
+			continue
+		}
+		change := mergeChange{start: pos, end: pos}
+		for i < len(ops) && ops[i].Kind != '=' {
+			if ops[i].Kind == '-' {
+				change.end++
+				pos++
+			} else {
+				change.lines = append(change.lines, ops[i].Text)
+			}
+			i++
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func applyChanges(base []string, changes []mergeChange, start, end int) []string {
+	var out []string
+	pos := start
+	for _, change := range changes {
+		out = append(out, base[pos:change.start]...)
+		out = append(out, change.lines...)
+		pos = change.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLines performs a three-way merge of ours and theirs against base.
+// Changes touching the same base lines on both sides, unless identical, are
+// kept as a conflict block with both versions and the original.
+func mergeLines(base, ours, theirs []string) ([]string, int) {
+	a := changesFrom(diffLines(base, ours))
+	b := changesFrom(diffLines(base, theirs))
+
+	var out []string
+	conflicts := 0
+	pos := 0
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var groupA, groupB []mergeChange
+		var start, end int
+		if j >= len(b) || (i < len(a) && a[i].start <= b[j].start) {
+			start, end = a[i].start, a[i].end
+			groupA = append(groupA, a[i])
+			i++
+		} else {
+			start, end = b[j].start, b[j].end
+			groupB = append(groupB, b[j])
+			j++
+		}
+
+		for {
+			if i < len(a) && a[i].start <= end {
+				end = max(end, a[i].end)
+				groupA = append(groupA, a[i])
+				i++
+			} else if j < len(b) && b[j].start <= end {
+				end = max(end, b[j].end)
+				groupB = append(groupB, b[j])
+				j++
+			} else {
+				break
+			}
+		}
+
+		out = append(out, base[pos:start]...)
+		pos = end
+
+		oursLines := applyChanges(base, groupA, start, end)
+		theirsLines := applyChanges(base, groupB, start, end)
+		switch {
+		case len(groupB) == 0:
+			out = append(out, oursLines...)
+		case len(groupA) == 0:
+			out = append(out, theirsLines...)
+		case equalLines(oursLines, theirsLines):
+			out = append(out, oursLines...)
+		default:
+			conflicts++
+			out = append(out, conflictOurs)
+			out = append(out, oursLines...)
+			out = append(out, conflictBase)
+			out = append(out, base[start:end]...)
+			out = append(out, conflictSep)
+			out = append(out, theirsLines...)
+			out = append(out, conflictTheirs)
+		}
+	}
+	out = append(out, base[pos:]...)
+	return out, conflicts
+}
+
+// mergeTexts merges whole texts. Lines keep their "\n" so that adding or
+// removing the final newline is merged like any other line change.
+func mergeTexts(base, ours, theirs string) (string, int) {
+	lines, conflicts := mergeLines(splitLinesWithEOL(base), splitLinesWithEOL(ours), splitLinesWithEOL(theirs))
+	for i, line := range lines {
+		last := i == len(lines)-1
+		if !strings.HasSuffix(line, "\n") && (!last || line == conflictTheirs) {
+			lines[i] += "\n"
+		}
+	}
+	return strings.Join(lines, ""), conflicts
+}
+
+func splitLinesWithEOL(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// handleMerge merges the editor buffer with the current remote file, using
+// the content loaded in the editor before the edits as the common base.
+func handleMerge(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		Path    string `json:"path"`
+		Base    string `json:"base"`
+		Content string `json:"content"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	req.Path = cleanRemotePath(req.Path)
+	if !remoteExists(req.Path) {
+		sendError(w, "Le fichier a été supprimé sur le serveur")
+		return
+	}
+	if _, tooLarge := isTooLargeToEdit(req.Path); tooLarge {
+		sendError(w, "Le fichier distant dépasse la taille éditable")
+		return
+	}
+
+	current, err := readRemoteFile(req.Path)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur de lecture: %v", err))
+		return
+	}
+	if isBinary(current) {
+		sendError(w, "Fichier binaire : fusion impossible")
+		return
+	}
+
+	remote, format := decodeText(current)
+	merged, conflicts := mergeTexts(req.Base, req.Content, remote)
+
+	message := "Fusion réussie"
+	if conflicts > 0 {
+		message = fmt.Sprintf("%d conflit(s) à résoudre", conflicts)
+	}
+	sendSuccess(w, message, map[string]interface{}{
+		"content":   merged,
+		"conflicts": conflicts,
+		"remote":    remote,
+		"format":    format,
+		"version":   contentVersion(current),
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflicts      int
+	}{
+		{"no changes", "a\nb", "a\nb", "a\nb", "a\nb", 0},
+		{"ours only", "a\nb\nc", "a\nB\nc", "a\nb\nc", "a\nB\nc", 0},
+		{"theirs only", "a\nb\nc", "a\nb\nc", "a\nb\nC", "a\nb\nC", 0},
+		{"separate changes", "a\nb\nc\nd\ne", "A\nb\nc\nd\ne", "a\nb\nc\nd\nE", "A\nb\nc\nd\nE", 0},
+		{"same change", "a\nb\nc", "a\nX\nc", "a\nX\nc", "a\nX\nc", 0},
+		{"insertions at both ends", "b", "a\nb", "b\nc", "a\nb\nc", 0},
+		{"deleted on one side", "a\nb\nc", "a\nc", "a\nb\nc", "a\nc", 0},
+		{
+			"conflict", "a\nb\nc", "a\nX\nc", "a\nY\nc",
+			"a\n" + conflictOurs + "\nX\n" + conflictBase + "\nb\n" + conflictSep + "\nY\n" + conflictTheirs + "\nc", 1,
+		},
+		{
+			"two conflicts", "a\nb\nc\nd\ne", "X\nb\nc\nd\nZ", "Y\nb\nc\nd\nW",
+			conflictOurs + "\nX\n" + conflictBase + "\na\n" + conflictSep + "\nY\n" + conflictTheirs + "\nb\nc\nd\n" +
+				conflictOurs + "\nZ\n" + conflictBase + "\ne\n" + conflictSep + "\nW\n" + conflictTheirs, 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, conflicts := mergeLines(splitLines(tt.base), splitLines(tt.ours), splitLines(tt.theirs))
+			if got := strings.Join(lines, "\n"); got != tt.want || conflicts != tt.wantConflicts {
+				t.Errorf("mergeLines() = %q, %d conflicts; want %q, %d", got, conflicts, tt.want, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestMergeTextsTrailingNewline(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantConflicts      int
+	}{
+		{"kept", "a\nb\n", "a\nB\n", "a\nb\n", "a\nB\n", 0},
+		{"added by theirs", "a\nb", "a\nb", "a\nb\nc\n", "a\nb\nc\n", 0},
+		{"added by ours", "a\nb", "a\nb\n", "a\nb", "a\nb\n", 0},
+		{"removed by theirs", "a\nb\n", "a\nb\n", "a\nb", "a\nb", 0},
+		{"removed by ours with theirs edit", "a\nb\nc\n", "a\nb\nc", "A\nb\nc\n", "A\nb\nc", 0},
+		{"empty base", "", "", "a\n", "a\n", 0},
+		{
+			"conflict on last line", "a\nb\n", "a\nX", "a\nY\n",
+			"a\n" + conflictOurs + "\nX\n" + conflictBase + "\nb\n" + conflictSep + "\nY\n" + conflictTheirs + "\n", 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := mergeTexts(tt.base, tt.ours, tt.theirs)
+			if got != tt.want || conflicts != tt.wantConflicts {
+				t.Errorf("mergeTexts(%q, %q, %q) = %q, %d conflicts; want %q, %d",
+					tt.base, tt.ours, tt.theirs, got, conflicts, tt.want, tt.wantConflicts)
+			}
+		})
+	}
+}
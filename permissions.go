@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+type PermissionsInfo struct {
+	Path  string `json:"path"`
+	Mode  string `json:"mode"`
+	IsDir bool   `json:"isDir"`
+	UID   uint32 `json:"uid"`
+	GID   uint32 `json:"gid"`
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+}
+
+func handlePermissions(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		p := cleanRemotePath(r.URL.Query().Get("path"))
+		if p == "" {
+			sendError(w, "Chemin requis")
+			return
+		}
+		info, err := permissionsInfo(p)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur: %v", err))
+			return
+		}
+		sendSuccess(w, "", info)
+		return
+	}
+
+	var req struct {
+		Path      string `json:"path"`
+		Mode      string `json:"mode"`
+		Owner     string `json:"owner"`
+		Group     string `json:"group"`
+		Recursive bool   `json:"recursive"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	req.Path = cleanRemotePath(req.Path)
+	if req.Path == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	var mode os.FileMode
+	if req.Mode != "" {
+		var err error
+		mode, err = parseMode(req.Mode)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Mode invalide: %s", req.Mode))
+			return
+		}
+	}
+
+	var err error
+	if server.useSudo {
+		err = changePermissionsWithSudo(req.Path, req.Mode, req.Owner, req.Group, req.Recursive)
+	} else {
+		err = changePermissionsWithSFTP(req.Path, req.Mode != "", mode, req.Owner, req.Group, req.Recursive)
+	}
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	info, err := permissionsInfo(req.Path)
+	if err != nil {
+		sendSuccess(w, "Permissions modifiées", nil)
+		return
+	}
+	sendSuccess(w, "Permissions modifiées", info)
+}
+
+func permissionsInfo(p string) (*PermissionsInfo, error) {
+	info, err := server.sftpClient.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PermissionsInfo{
+		Path:  p,
+		Mode:  formatMode(info.Mode()),
+		IsDir: info.IsDir(),
+	}
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		result.UID = stat.UID
+		result.GID = stat.GID
+		result.Owner = lookupName("/etc/passwd", stat.UID)
+		result.Group = lookupName("/etc/group", stat.GID)
+	}
+	return result, nil
+}
+
+func parseMode(s string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || bits > 07777 {
+		return 0, fmt.Errorf("mode invalide")
+	}
+
+	mode := os.FileMode(bits & 0777)
+	if bits&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+func formatMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+func readIDDatabase(file string) []string {
+	f, err := server.sftpClient.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	return strings.Split(string(data), "\n")
+}
+
+func lookupName(file string, id uint32) string {
+	for _, line := range readIDDatabase(file) {
+		fields := strings.Split(line, ":")
+		if len(fields) >= 3 && fields[2] == strconv.FormatUint(uint64(id), 10) {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+func lookupID(file, name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	for _, line := range readIDDatabase(file) {
+		fields := strings.Split(line, ":")
+		if len(fields) >= 3 && fields[0] == name {
+			return strconv.Atoi(fields[2])
+		}
+	}
+	return 0, fmt.Errorf("%s introuvable dans %s", name, file)
+}
+
+func changePermissionsWithSFTP(root string, setMode bool, mode os.FileMode, owner, group string, recursive bool) error {
+	uid, gid := -1, -1
+	if owner != "" {
+		id, err := lookupID("/etc/passwd", owner)
+		if err != nil {
+			return err
+		}
+		uid = id
+	}
+	if group != "" {
+		id, err := lookupID("/etc/group", group)
+		if err != nil {
+			return err
+		}
+		gid = id
+	}
+
+	apply := func(p string, info os.FileInfo) error {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		if setMode {
+			if err := server.sftpClient.Chmod(p, mode); err != nil {
+				return err
+			}
+		}
+		if uid >= 0 || gid >= 0 {
+			newUID, newGID := uid, gid
+			if stat, ok := info.Sys().(*sftp.FileStat); ok {
+				if newUID < 0 {
+					newUID = int(stat.UID)
+				}
+				if newGID < 0 {
+					newGID = int(stat.GID)
+				}
+			}
+			if err := server.sftpClient.Chown(p, newUID, newGID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !recursive {
+		info, err := server.sftpClient.Lstat(root)
+		if err != nil {
+			return err
+		}
+		return apply(root, info)
+	}
+
+	walker := server.sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if err := apply(walker.Path(), walker.Stat()); err != nil {
+			return fmt.Errorf("%s: %v", walker.Path(), err)
+		}
+	}
+	return nil
+}
+
+func changePermissionsWithSudo(p, mode, owner, group string, recursive bool) error {
+	flags := ""
+	if recursive {
+		flags = "-R "
+	}
+
+	var commands []string
+	if mode != "" {
+		commands = append(commands, fmt.Sprintf("chmod %s%s -- %s", flags, mode, shellQuote(p)))
+	}
+	if owner != "" || group != "" {
+		spec := owner
+		if group != "" {
+			spec += ":" + group
+		}
+		commands = append(commands, fmt.Sprintf("chown %s%s -- %s", flags, shellQuote(spec), shellQuote(p)))
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+
+	output, err := runRemoteCommand(strings.Join(commands, " && "))
+	if err != nil {
+		return commandError(output, err)
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	maxIndexedFiles   = 200000
+	maxQuickOpenQuery = 64
+	quickOpenLimit    = 50
+)
+
+// FileIndex holds every file path under rootPath for quick open. It is
+// rebuilt from the tree walk and kept current from watcher events.
+type FileIndex struct {
+	mu    sync.RWMutex
+	files map[string]struct{}
+	ready bool
+}
+
+type QuickOpenResult struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Dir       string `json:"dir"`
+	Score     int    `json:"score"`
+	InName    bool   `json:"inName"`
+	Positions []int  `json:"positions"`
+}
+
+func newFileIndex() *FileIndex {
+	return &FileIndex{files: map[string]struct{}{}}
+}
+
+func indexIgnored(p string) bool {
+	for _, part := range strings.Split(p, "/") {
+		for _, name := range defaultSearchIgnores {
+			if part == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (idx *FileIndex) addNodes(nodes []*FileNode) {
+	for _, node := range nodes {
+		if len(idx.files) >= maxIndexedFiles {
+			return
+		}
+		if indexIgnored(node.Path) {
+			continue
+		}
+		if node.IsDir {
+			idx.addNodes(node.Children)
+		} else {
+			idx.files[node.Path] = struct{}{}
+		}
+	}
+}
+
+func (idx *FileIndex) replace(nodes []*FileNode) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.files = map[string]struct{}{}
+	idx.addNodes(nodes)
+	idx.ready = true
+}
+
+func (idx *FileIndex) remove(p string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.files, p)
+	prefix := p + "/"
+	for file := range idx.files {
+		if strings.HasPrefix(file, prefix) {
+			delete(idx.files, file)
+		}
+	}
+}
+
+// follow applies watcher events to the index until the watcher is closed.
+func (idx *FileIndex) follow(watcher *Watcher) {
+	for event := range watcher.subscribe() {
+		switch {
+		case event.Type == "delete":
+			idx.remove(event.Path)
+		case event.Type == "create" && event.IsDir:
+			// Walking a large new folder here would block the subscriber
+			// and let the watcher drop the events that follow.
+			go idx.addTree(event.Path)
+		case event.Type == "create":
+			idx.mu.Lock()
+			if !indexIgnored(event.Path) {
+				idx.files[event.Path] = struct{}{}
+			}
+			idx.mu.Unlock()
+		}
+	}
+}
+
+func (idx *FileIndex) addTree(p string) {
+	nodes, err := buildTree(p)
+	if err != nil {
+		return
+	}
+	idx.mu.Lock()
+	idx.addNodes(nodes)
+	idx.mu.Unlock()
+}
+
+func (idx *FileIndex) ensure() error {
+	idx.mu.RLock()
+	ready := idx.ready
+	idx.mu.RUnlock()
+	if ready {
+		return nil
+	}
+
+	nodes, err := buildTree(server.rootPath)
+	if err != nil {
+		return err
+	}
+	idx.replace(nodes)
+	return nil
+}
+
+func isWordSeparator(r rune) bool {
+	switch r {
+	case '/', '\\', '_', '-', '.', ' ':
+		return true
+	}
+	return false
+}
+
+// fuzzyScore matches the query characters in order against target and
+// returns the best alignment, rewarding matches at the start, after a
+// separator or a camelCase boundary, and runs of consecutive characters.
+func fuzzyScore(query, target []rune) (int, []int, bool) {
+	n, m := len(query), len(target)
+	if n == 0 || n > m {
+		return 0, nil, n == 0
+	}
+
+	lowerTarget := make([]rune, m)
+	for j, r := range target {
+		lowerTarget[j] = unicode.ToLower(r)
+	}
+	i := 0
+	for j := 0; j < m && i < n; j++ {
+		if unicode.ToLower(query[i]) == lowerTarget[j] {
+			i++
+		}
+	}
+	if i < n {
+		return 0, nil, false
+	}
+
+	const none = -1 << 30
+	score := make([][]int, n)
+	from := make([][]int, n)
+	for i := range score {
+		score[i] = make([]int, m)
+		from[i] = make([]int, m)
+	}
+
+	for i := 0; i < n; i++ {
+		q := unicode.ToLower(query[i])
+		best, bestAt := none, -1
+		for j := 0; j < m; j++ {
+			if i > 0 && j > 0 && score[i-1][j-1] > best {
+				best, bestAt = score[i-1][j-1], j-1
+			}
+			score[i][j] = none
+			if lowerTarget[j] != q || (i > 0 && bestAt < 0) {
+				continue
+			}
+
+			char := 1
+			if query[i] == target[j] {
+				char++
+			}
+			switch {
+			case j == 0:
+				char += 8
+			case isWordSeparator(target[j-1]):
+				char += 7
+			case unicode.IsLower(target[j-1]) && unicode.IsUpper(target[j]):
+				char += 5
+			}
+
+			if i == 0 {
+				score[i][j] = char
+				from[i][j] = -1
+				continue
+			}
+			score[i][j], from[i][j] = best+char, bestAt
+			if j > 0 && score[i-1][j-1] != none && score[i-1][j-1]+char+5 > score[i][j] {
+				score[i][j], from[i][j] = score[i-1][j-1]+char+5, j-1
+			}
+		}
+	}
+
+	end := -1
+	for j := 0; j < m; j++ {
+		if score[n-1][j] != none && (end < 0 || score[n-1][j] > score[n-1][end]) {
+			end = j
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	positions := make([]int, n)
+	for i, j := n-1, end; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+	return score[n-1][end], positions, true
+}
+
+// search ranks indexed files: matches in the file name come before matches
+// spanning the directory, then higher scores and shorter paths win.
+func (idx *FileIndex) search(query, root string, limit int) ([]QuickOpenResult, int) {
+	q := []rune(strings.ReplaceAll(query, " ", ""))
+	if len(q) > maxQuickOpenQuery {
+		q = q[:maxQuickOpenQuery]
+	}
+	prefix := strings.TrimSuffix(root, "/") + "/"
+
+	idx.mu.RLock()
+	total := len(idx.files)
+	var results []QuickOpenResult
+	for file := range idx.files {
+		rel := strings.TrimPrefix(file, prefix)
+		result := QuickOpenResult{Path: file, Name: path.Base(file), Dir: path.Dir(rel)}
+		if result.Dir == "." {
+			result.Dir = ""
+		}
+		if !strings.ContainsRune(string(q), '/') {
+			if score, positions, ok := fuzzyScore(q, []rune(result.Name)); ok {
+				result.Score, result.Positions, result.InName = score+1000, positions, true
+				results = append(results, result)
+				continue
+			}
+		}
+		if score, positions, ok := fuzzyScore(q, []rune(rel)); ok {
+			result.Score, result.Positions = score, positions
+			results = append(results, result)
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+		return a.Path < b.Path
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, total
+}
+
+func handleQuickOpen(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil || server.index == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	if err := server.index.ensure(); err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	limit := quickOpenLimit
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	results, total := server.index.search(r.URL.Query().Get("q"), defaultParent(), limit)
+	sendSuccess(w, "", map[string]interface{}{
+		"results": results,
+		"indexed": total,
+	})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// rawContentSecurityPolicy is sent with every /api/raw response so that a
+// remote file opened directly in the browser can never run scripts under the
+// editor's origin. PDFs drop the sandbox, which browsers refuse to render them
+// in; their viewer does not run page scripts.
+const (
+	rawContentSecurityPolicy = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; sandbox"
+	pdfContentSecurityPolicy = "default-src 'none'; object-src 'self'; style-src 'unsafe-inline'"
+)
+
+func handleRaw(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	p := cleanRemotePath(r.URL.Query().Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	file, err := server.sftpClient.Open(p)
+	if err != nil {
+		if server.useSudo {
+			serveRawWithSudo(w, r, p)
+			return
+		}
+		sendError(w, fmt.Sprintf("Impossible d'ouvrir: %v", err))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	sniff := make([]byte, 512)
+	n, _ := io.ReadFull(file, sniff)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	setRawHeaders(w, p, sniff[:n])
+	http.ServeContent(w, r, path.Base(p), info.ModTime(), file)
+}
+
+func serveRawWithSudo(w http.ResponseWriter, r *http.Request, p string) {
+	size, err := remoteSize(p)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Impossible d'ouvrir: %v", err))
+		return
+	}
+	sniff, err := readRange(p, 0, 512)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Impossible d'ouvrir: %v", err))
+		return
+	}
+
+	setRawHeaders(w, p, sniff)
+	w.Header().Set("Accept-Ranges", "bytes")
+	start, length := int64(0), size
+	if header := r.Header.Get("Range"); header != "" {
+		var ok bool
+		start, length, ok = parseRange(header, size)
+		if !ok {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	if err := streamRange(p, start, length, w); err != nil {
+		log.Printf("lecture de %s interrompue: %v", p, err)
+	}
+}
+
+// parseRange parses a single "bytes=" range against size. Multiple ranges
+// are not supported and are treated as unsatisfiable.
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		n = min(n, size)
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
+
+// rawContentType sniffs the content first, so that a file cannot be labelled
+// as media by its name alone. The extension is only trusted for formats the
+// sniffer does not know (flac, mov, m4a, svg...) when the content does not
+// look like anything more dangerous.
+func rawContentType(p string, sniff []byte) string {
+	sniffed := http.DetectContentType(sniff)
+	byName := mime.TypeByExtension(strings.ToLower(path.Ext(p)))
+
+	switch {
+	case isInlineType(sniffed):
+		return sniffed
+	case sniffed == "application/ogg":
+		if strings.HasPrefix(byName, "video/") {
+			return byName
+		}
+		return "audio/ogg"
+	case sniffed == "application/octet-stream" && (strings.HasPrefix(byName, "audio/") || strings.HasPrefix(byName, "video/")):
+		return byName
+	case strings.HasPrefix(byName, "image/svg") && (strings.HasPrefix(sniffed, "text/xml") || strings.HasPrefix(sniffed, "text/plain")):
+		return byName
+	case strings.HasPrefix(sniffed, "text/"):
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func isInlineType(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") ||
+		strings.HasPrefix(contentType, "audio/") ||
+		strings.HasPrefix(contentType, "video/") ||
+		contentType == "application/pdf"
+}
+
+func setRawHeaders(w http.ResponseWriter, p string, sniff []byte) {
+	contentType := rawContentType(p, sniff)
+	disposition := "inline"
+	if contentType == "application/octet-stream" {
+		disposition = "attachment"
+	}
+	policy := rawContentSecurityPolicy
+	if contentType == "application/pdf" {
+		policy = pdfContentSecurityPolicy
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", policy)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(p)}))
+}
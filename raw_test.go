@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestRawContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	html := []byte("<!DOCTYPE html><html><script>alert(1)</script></html>")
+	svg := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+	binary := []byte{0x00, 0x01, 0x02, 0x03, 0xff}
+
+	tests := []struct {
+		name  string
+		path  string
+		sniff []byte
+		want  string
+	}{
+		{"png", "a.png", png, "image/png"},
+		{"png with another name", "a.txt", png, "image/png"},
+		{"html named png", "a.png", html, "text/plain; charset=utf-8"},
+		{"html", "index.html", html, "text/plain; charset=utf-8"},
+		{"html named mp4", "a.mp4", html, "text/plain; charset=utf-8"},
+		{"svg", "logo.svg", svg, "image/svg+xml"},
+		{"xml", "feed.xml", svg, "text/plain; charset=utf-8"},
+		{"pdf", "doc.pdf", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"unknown audio by name", "song.flac", binary, "audio/flac"},
+		{"unknown binary", "data.bin", binary, "application/octet-stream"},
+		{"binary named html", "page.html", binary, "application/octet-stream"},
+		{"ogg", "song.ogg", []byte("OggS\x00\x02"), "audio/ogg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rawContentType(tt.path, tt.sniff); got != tt.want {
+				t.Errorf("rawContentType(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header        string
+		size          int64
+		start, length int64
+		ok            bool
+	}{
+		{"bytes=0-99", 1000, 0, 100, true},
+		{"bytes=500-", 1000, 500, 500, true},
+		{"bytes=-200", 1000, 800, 200, true},
+		{"bytes=-2000", 1000, 0, 1000, true},
+		{"bytes=900-5000", 1000, 900, 100, true},
+		{"bytes=1000-", 1000, 0, 0, false},
+		{"bytes=5-1", 1000, 0, 0, false},
+		{"bytes=0-1,5-6", 1000, 0, 0, false},
+		{"items=0-1", 1000, 0, 0, false},
+		{"bytes=-0", 1000, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		start, length, ok := parseRange(tt.header, tt.size)
+		if ok != tt.ok || (ok && (start != tt.start || length != tt.length)) {
+			t.Errorf("parseRange(%q, %d) = %d, %d, %v; want %d, %d, %v", tt.header, tt.size, start, length, ok, tt.start, tt.length, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxReplaceFiles = 200
+
+type ReplaceOptions struct {
+	Pattern     string  `json:"pattern"`
+	Replacement string  `json:"replacement"`
+	Regex       bool    `json:"regex"`
+	Case        bool    `json:"case"`
+	Ignore      *string `json:"ignore"`
+	MaxSize     int64   `json:"maxSize"`
+}
+
+type ReplacePreview struct {
+	Path    string    `json:"path"`
+	Version string    `json:"version"`
+	Count   int       `json:"count"`
+	Diff    *FileDiff `json:"diff,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type replaceEdit struct {
+	current  []byte
+	text     string
+	replaced string
+	encoded  []byte
+	count    int
+}
+
+// searcher builds a searcher with the same matching rules as the content
+// search. Remote matches are filtered through the same Go matcher as the
+// replacement, so the preview lists the files the replacement changes.
+func (opts ReplaceOptions) searcher() (*searcher, error) {
+	query := map[string][]string{"q": {opts.Pattern}}
+	if opts.Regex {
+		query["regex"] = []string{"1"}
+	}
+	if opts.Case {
+		query["case"] = []string{"1"}
+	}
+	if opts.Ignore != nil {
+		query["ignore"] = []string{*opts.Ignore}
+	}
+	if opts.MaxSize > 0 {
+		query["maxSize"] = []string{strconv.FormatInt(opts.MaxSize, 10)}
+	}
+	return newSearcher(query)
+}
+
+// replaceText applies the replacement line by line, like the search
+// matches, and returns the new text with the number of replacements.
+// In regex mode, $1 or ${name} in the replacement expand to groups.
+func (s *searcher) replaceText(text, replacement string) (string, int) {
+	lines := strings.Split(text, "\n")
+	count := 0
+	for i, line := range lines {
+		matches := s.matcher.FindAllStringIndex(line, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		count += len(matches)
+		if s.regex {
+			lines[i] = s.matcher.ReplaceAllString(line, replacement)
+		} else {
+			lines[i] = s.matcher.ReplaceAllLiteralString(line, replacement)
+		}
+	}
+	return strings.Join(lines, "\n"), count
+}
+
+func (s *searcher) prepareReplace(p, replacement string) (*replaceEdit, error) {
+	if _, tooLarge := isTooLargeToEdit(p); tooLarge {
+		return nil, fmt.Errorf("fichier trop volumineux")
+	}
+	current, err := readRemoteFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(current) {
+		return nil, fmt.Errorf("fichier binaire")
+	}
+
+	text, format := decodeText(current)
+	replaced, count := s.replaceText(text, replacement)
+	edit := &replaceEdit{current: current, text: text, replaced: replaced, count: count}
+	if count == 0 {
+		return edit, nil
+	}
+
+	edit.encoded, err = encodeText(replaced, format)
+	if err != nil {
+		return nil, err
+	}
+	return edit, nil
+}
+
+// matchingFiles lists the files containing the pattern under rootPath.
+func (s *searcher) matchingFiles(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	s.emit = func(m SearchMatch) {
+		if !seen[m.File] {
+			seen[m.File] = true
+			files = append(files, m.File)
+		}
+	}
+	if _, err := s.run(ctx); err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func handleReplacePreview(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		ReplaceOptions
+		Files []string `json:"files"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	s, err := req.searcher()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	files := req.Files
+	if len(files) == 0 {
+		files, err = s.matchingFiles(r.Context())
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur de recherche: %v", err))
+			return
+		}
+	}
+	truncated := s.truncated || len(files) > maxReplaceFiles
+	if len(files) > maxReplaceFiles {
+		files = files[:maxReplaceFiles]
+	}
+
+	previews := []ReplacePreview{}
+	total := 0
+	for _, p := range files {
+		p = cleanRemotePath(p)
+		edit, err := s.prepareReplace(p, req.Replacement)
+		if err != nil {
+			previews = append(previews, ReplacePreview{Path: p, Error: err.Error()})
+			continue
+		}
+		if edit.count == 0 {
+			continue
+		}
+		total += edit.count
+		previews = append(previews, ReplacePreview{
+			Path:    p,
+			Version: contentVersion(edit.current),
+			Count:   edit.count,
+			Diff:    diffTexts(p, p, edit.text, edit.replaced),
+		})
+	}
+
+	sendSuccess(w, "", map[string]interface{}{
+		"files":     previews,
+		"total":     total,
+		"truncated": truncated,
+	})
+}
+
+// handleReplaceApply writes the confirmed files through the save path. A
+// file that changed since the preview is left untouched and reported.
+func handleReplaceApply(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		ReplaceOptions
+		Files []struct {
+			Path    string `json:"path"`
+			Version string `json:"version"`
+		} `json:"files"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+	if len(req.Files) == 0 {
+		sendError(w, "Aucun fichier sélectionné")
+		return
+	}
+
+	s, err := req.searcher()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	applied := []ReplacePreview{}
+	failed := []ReplacePreview{}
+	user := webUser(r)
+	for _, file := range req.Files {
+		p := cleanRemotePath(file.Path)
+		edit, err := s.prepareReplace(p, req.Replacement)
+		switch {
+		case err != nil:
+			failed = append(failed, ReplacePreview{Path: p, Error: err.Error()})
+			continue
+		case contentVersion(edit.current) != file.Version:
+			failed = append(failed, ReplacePreview{Path: p, Error: "modifié sur le serveur depuis l'aperçu"})
+			continue
+		case edit.count == 0:
+			continue
+		}
+
+		if err := writeRemoteFile(p, edit.encoded); err != nil {
+			failed = append(failed, ReplacePreview{Path: p, Error: fmt.Sprintf("écriture: %v", err)})
+			continue
+		}
+		recordSave(p, edit.current, edit.encoded, user)
+		applied = append(applied, ReplacePreview{Path: p, Version: contentVersion(edit.encoded), Count: edit.count})
+	}
+
+	message := fmt.Sprintf("%d fichier(s) modifié(s)", len(applied))
+	if len(failed) > 0 {
+		message += fmt.Sprintf(", %d en échec", len(failed))
+	}
+	sendSuccess(w, message, map[string]interface{}{
+		"applied": applied,
+		"failed":  failed,
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// handleSaveReview diffs the editor buffer against the file currently on the
+// server, so that changes can be reviewed before saving.
+func handleSaveReview(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		Path    string      `json:"path"`
+		Content string      `json:"content"`
+		Version string      `json:"version"`
+		Format  *TextFormat `json:"format"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	req.Path = cleanRemotePath(req.Path)
+	if req.Path == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	remoteVersion := missingVersion
+	var remoteText string
+	var remoteFormat TextFormat
+	if remoteExists(req.Path) {
+		if _, tooLarge := isTooLargeToEdit(req.Path); tooLarge {
+			sendError(w, "Le fichier distant dépasse la taille éditable")
+			return
+		}
+		current, err := readRemoteFile(req.Path)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur de lecture: %v", err))
+			return
+		}
+		remoteVersion = contentVersion(current)
+		remoteText, remoteFormat = decodeText(current)
+	}
+
+	formatChanged := false
+	if req.Format != nil && remoteVersion != missingVersion {
+		formatChanged = req.Format.Encoding != remoteFormat.Encoding ||
+			req.Format.BOM != remoteFormat.BOM ||
+			req.Format.EOL != remoteFormat.EOL ||
+			remoteFormat.MixedEOL
+	}
+
+	sendSuccess(w, "", map[string]interface{}{
+		"diff":          diffTexts(req.Path+" (serveur)", req.Path+" (éditeur)", remoteText, req.Content),
+		"version":       remoteVersion,
+		"changed":       req.Version != "" && req.Version != remoteVersion,
+		"deleted":       remoteVersion == missingVersion,
+		"format":        remoteFormat,
+		"formatChanged": formatChanged,
+	})
+}
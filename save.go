@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+)
+
+const maxSymlinkDepth = 40
+
+func resolveSymlinks(p string) (string, error) {
+	for i := 0; i < maxSymlinkDepth; i++ {
+		info, err := server.sftpClient.Lstat(p)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return p, nil
+		}
+
+		target, err := server.sftpClient.ReadLink(p)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		p = path.Clean(target)
+	}
+	return "", fmt.Errorf("trop de liens symboliques: %s", p)
+}
+
+func tempSiblingPath(target string) (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return path.Join(path.Dir(target), "."+path.Base(target)+".ssh-editor-"+hex.EncodeToString(suffix)), nil
+}
+
+// writeRemoteFile is the common save path: an atomic write over SFTP, or a
+// staged file installed as root in sudo mode.
+func writeRemoteFile(target string, content []byte) error {
+	if server.useSudo {
+		return writeFileWithSudo(target, string(content))
+	}
+	return writeFileAtomic(target, content)
+}
+
+// writeFileAtomic writes content next to the target, carries over its mode
+// and ownership, then renames it into place. When the directory is not
+// writable or ownership cannot be preserved, it falls back to an in-place
+// write so the original file is never replaced by one owned by someone else.
+func writeFileAtomic(target string, content []byte) error {
+	resolved, err := resolveSymlinks(target)
+	if err != nil {
+		return err
+	}
+
+	original, statErr := server.sftpClient.Stat(resolved)
+
+	tmp, err := tempSiblingPath(resolved)
+	if err != nil {
+		return err
+	}
+
+	file, err := server.sftpClient.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return writeFileInPlace(resolved, content)
+	}
+
+	if err := writeAndSync(file, content); err != nil {
+		server.sftpClient.Remove(tmp)
+		return err
+	}
+
+	if statErr == nil {
+		if err := server.sftpClient.Chmod(tmp, original.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+			server.sftpClient.Remove(tmp)
+			return err
+		}
+		if stat, ok := original.Sys().(*sftp.FileStat); ok {
+			if err := server.sftpClient.Chown(tmp, int(stat.UID), int(stat.GID)); err != nil {
+				server.sftpClient.Remove(tmp)
+				return writeFileInPlace(resolved, content)
+			}
+		}
+	}
+
+	if err := replaceFile(tmp, resolved, statErr == nil); err != nil {
+		server.sftpClient.Remove(tmp)
+		if errors.Is(err, errReplaceUnsupported) {
+			return writeFileInPlace(resolved, content)
+		}
+		return err
+	}
+	return nil
+}
+
+var errReplaceUnsupported = errors.New("remplacement impossible")
+
+// replaceFile renames tmp over target. Servers without the posix-rename
+// extension refuse to rename over an existing file, so the original is moved
+// aside first and put back if tmp cannot take its place.
+func replaceFile(tmp, target string, exists bool) error {
+	if err := server.sftpClient.PosixRename(tmp, target); err == nil {
+		return nil
+	}
+	if !exists {
+		return server.sftpClient.Rename(tmp, target)
+	}
+
+	aside, err := tempSiblingPath(target)
+	if err != nil {
+		return err
+	}
+	if err := server.sftpClient.Rename(target, aside); err != nil {
+		return errReplaceUnsupported
+	}
+	if err := server.sftpClient.Rename(tmp, target); err != nil {
+		server.sftpClient.Rename(aside, target)
+		return err
+	}
+	server.sftpClient.Remove(aside)
+	return nil
+}
+
+func writeAndSync(file *sftp.File, content []byte) error {
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	var status *sftp.StatusError
+	if err := file.Sync(); err != nil && !(errors.As(err, &status) && status.FxCode() == sftp.ErrSSHFxOpUnsupported) {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeFileInPlace(target string, content []byte) error {
+	file, err := server.sftpClient.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	return writeAndSync(file, content)
+}
+
+// atomicWriteScript installs a staged file over target as root, keeping the
+// original mode and ownership and writing through symlinks. A new file gets
+// the umask default rather than mktemp's 0600.
+func atomicWriteScript(target, staging string) string {
+	return fmt.Sprintf(`set -e
+t=$(readlink -f -- %[1]s 2>/dev/null) || t=%[1]s
+tmp=$(mktemp "$(dirname -- "$t")/.ssh-editor.XXXXXX")
+trap 'rm -f -- "$tmp"' EXIT
+cat -- %[2]s > "$tmp"
+if [ -e "$t" ]; then
+	chmod "$(stat -c %%a -- "$t")" -- "$tmp"
+	chown "$(stat -c %%u:%%g -- "$t")" -- "$tmp"
+else
+	chmod "$(printf %%o $((0666 & ~$(umask))))" -- "$tmp"
+fi
+sync -- "$tmp" 2>/dev/null || sync
+mv -f -- "$tmp" "$t"
+trap - EXIT`, shellQuote(target), shellQuote(staging))
+}
+
+func writeStagedWithSudo(target string, content io.Reader) error {
+	staging, _, err := stageFile(content)
+	if staging != "" {
+		defer server.sftpClient.Remove(staging)
+	}
+	if err != nil {
+		return err
+	}
+
+	output, err := runRemoteCommand(atomicWriteScript(target, staging))
+	if err != nil {
+		return commandError(output, err)
+	}
+	return nil
+}
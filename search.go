@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	maxSearchResults    = 1000
+	maxSearchContext    = 5
+	maxSearchLineLength = 300
+	defaultSearchSize   = 1 << 20
+)
+
+var defaultSearchIgnores = []string{".git", ".svn", ".hg", "node_modules", "__pycache__", trashDirName}
+
+type SearchMatch struct {
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+type searchLine struct {
+	num   int
+	text  string
+	match bool
+}
+
+type searcher struct {
+	root      string
+	pattern   string
+	regex     bool
+	matchCase bool
+	ignore    []string
+	maxSize   int64
+	context   int
+	matcher   *regexp.Regexp
+	emit      func(SearchMatch)
+	count     int
+	truncated bool
+}
+
+func newSearcher(query map[string][]string) (*searcher, error) {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	s := &searcher{
+		root:      cleanRemotePath(get("path")),
+		pattern:   get("q"),
+		regex:     get("regex") == "1",
+		matchCase: get("case") == "1",
+		ignore:    defaultSearchIgnores,
+		maxSize:   defaultSearchSize,
+		context:   2,
+	}
+	if s.pattern == "" {
+		return nil, fmt.Errorf("motif requis")
+	}
+	if s.root == "" {
+		s.root = defaultParent()
+	}
+	if _, ok := query["ignore"]; ok {
+		s.ignore = nil
+		for _, glob := range strings.Split(get("ignore"), ",") {
+			if glob = strings.TrimSpace(glob); glob != "" {
+				s.ignore = append(s.ignore, glob)
+			}
+		}
+	}
+	if v := get("maxSize"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("taille maximale invalide")
+		}
+		s.maxSize = size
+	}
+	if v := get("context"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("contexte invalide")
+		}
+		s.context = min(n, maxSearchContext)
+	}
+
+	expr := s.pattern
+	if !s.regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if !s.matchCase {
+		expr = "(?i)" + expr
+	}
+	matcher, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("expression régulière invalide: %v", err)
+	}
+	s.matcher = matcher
+	return s, nil
+}
+
+// add reports a match and returns false once the result limit is reached.
+func (s *searcher) add(m SearchMatch) bool {
+	if s.count >= maxSearchResults {
+		s.truncated = true
+		return false
+	}
+	s.count++
+
+	m.Column = 1
+	if loc := s.matcher.FindStringIndex(m.Text); loc != nil {
+		m.Column = utf8.RuneCountInString(m.Text[:loc[0]]) + 1
+		m.Text = clipLine(m.Text, loc[0])
+	} else {
+		m.Text = clipLine(m.Text, 0)
+	}
+	for i := range m.Before {
+		m.Before[i] = clipLine(m.Before[i], 0)
+	}
+	for i := range m.After {
+		m.After[i] = clipLine(m.After[i], 0)
+	}
+	s.emit(m)
+	return true
+}
+
+// clipLine shortens long lines (minified files) to a window around offset.
+func clipLine(text string, offset int) string {
+	if len(text) <= maxSearchLineLength {
+		return text
+	}
+	start := max(0, offset-maxSearchLineLength/3)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	end := min(len(text), start+maxSearchLineLength)
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	clipped := text[start:end]
+	if start > 0 {
+		clipped = "…" + clipped
+	}
+	if end < len(text) {
+		clipped += "…"
+	}
+	return clipped
+}
+
+func (s *searcher) ignored(name, rel string) bool {
+	return matchesIgnore(s.ignore, name, rel)
+}
+
+// matchesIgnore reports whether an entry matches one of the globs: against
+// its base name, or against its relative path when the glob has a slash.
+func matchesIgnore(globs []string, name, rel string) bool {
+	for _, glob := range globs {
+		target := name
+		if strings.Contains(glob, "/") {
+			target = rel
+		}
+		if ok, _ := path.Match(glob, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *searcher) ripgrepCommand() string {
+	args := []string{"rg", "--null", "--line-number", "--no-heading", "--color", "never", "--hidden",
+		"--context", strconv.Itoa(s.context), "--max-filesize", strconv.FormatInt(s.maxSize, 10)}
+	if !s.matchCase {
+		args = append(args, "--ignore-case")
+	}
+	if !s.regex {
+		args = append(args, "--fixed-strings")
+	}
+	for _, glob := range s.ignore {
+		args = append(args, "--glob", shellQuote("!"+glob))
+	}
+	args = append(args, "-e", shellQuote(s.pattern), "--", shellQuote(s.root))
+	return strings.Join(args, " ")
+}
+
+func (s *searcher) grepCommand() string {
+	var find []string
+	find = append(find, "find", shellQuote(s.root))
+	if len(s.ignore) > 0 {
+		var tests []string
+		for _, glob := range s.ignore {
+			if strings.Contains(glob, "/") {
+				tests = append(tests, "-path", shellQuote(path.Join(s.root, glob)))
+			} else {
+				tests = append(tests, "-name", shellQuote(glob))
+			}
+			tests = append(tests, "-o")
+		}
+		find = append(find, `\(`)
+		find = append(find, tests[:len(tests)-1]...)
+		find = append(find, `\)`, "-prune", "-o")
+	}
+	find = append(find, "-type", "f", "-size", fmt.Sprintf("-%dc", s.maxSize+1), "-print0")
+
+	grep := []string{"xargs", "-0", "-r", "grep", "-nHIsZ", "-C", strconv.Itoa(s.context)}
+	if !s.matchCase {
+		grep = append(grep, "-i")
+	}
+	if s.regex {
+		grep = append(grep, "-P")
+	} else {
+		grep = append(grep, "-F")
+	}
+	grep = append(grep, "-e", shellQuote(s.pattern), "--")
+
+	return strings.Join(find, " ") + " | " + strings.Join(grep, " ")
+}
+
+// parseSearchLine parses "file\0NUM:text" (match) or "file\0NUM-text"
+// (context), as printed by both grep -Z and rg --null.
+func parseSearchLine(line string) (string, searchLine, bool) {
+	file, rest, ok := strings.Cut(line, "\x00")
+	if !ok {
+		return "", searchLine{}, false
+	}
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	if i == 0 || i == len(rest) || (rest[i] != ':' && rest[i] != '-') {
+		return "", searchLine{}, false
+	}
+	num, _ := strconv.Atoi(rest[:i])
+	return file, searchLine{num: num, text: rest[i+1:], match: rest[i] == ':'}, true
+}
+
+// flushBlock turns a contiguous run of output lines into matches with their
+// surrounding context.
+func (s *searcher) flushBlock(file string, lines []searchLine) bool {
+	for i, line := range lines {
+		if !line.match || !s.matcher.MatchString(strings.TrimSuffix(line.text, "\r")) {
+			continue
+		}
+		m := SearchMatch{File: file, Line: line.num, Text: line.text}
+		for _, ctx := range lines[max(0, i-s.context):i] {
+			if ctx.num >= line.num-s.context {
+				m.Before = append(m.Before, ctx.text)
+			}
+		}
+		for _, ctx := range lines[i+1 : min(len(lines), i+1+s.context)] {
+			if ctx.num <= line.num+s.context {
+				m.After = append(m.After, ctx.text)
+			}
+		}
+		if !s.add(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *searcher) runRemote(ctx context.Context, cmd string) error {
+	var file string
+	var block []searchLine
+	stopped := false
+	err := streamRemoteLines(ctx, cmd, func(line string) bool {
+		if line == "" {
+			return true
+		}
+		name, parsed, ok := parseSearchLine(line)
+		if !ok || name != file {
+			if !s.flushBlock(file, block) {
+				stopped = true
+				return false
+			}
+			block = nil
+		}
+		if ok {
+			file = name
+			block = append(block, parsed)
+		}
+		return true
+	})
+	if stopped || ctx.Err() != nil || !s.flushBlock(file, block) {
+		return nil
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		// grep and rg exit with 1 when nothing matched, xargs with 123.
+		switch exitErr.ExitStatus() {
+		case 1, 123:
+			return nil
+		case 2:
+			if s.count > 0 {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+func (s *searcher) walkSFTP(ctx context.Context) error {
+	walker := server.sftpClient.Walk(s.root)
+	for walker.Step() {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if walker.Err() != nil {
+			continue
+		}
+
+		p := walker.Path()
+		info := walker.Stat()
+		if p != s.root && s.ignored(info.Name(), strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")) {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() || info.Size() > s.maxSize {
+			continue
+		}
+
+		file, err := server.sftpClient.Open(p)
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || isBinary(content) {
+			continue
+		}
+
+		text, _ := decodeText(content)
+		lines := splitLines(text)
+		for i, line := range lines {
+			if !s.matcher.MatchString(line) {
+				continue
+			}
+			m := SearchMatch{
+				File:   p,
+				Line:   i + 1,
+				Text:   line,
+				Before: append([]string(nil), lines[max(0, i-s.context):i]...),
+				After:  append([]string(nil), lines[i+1:min(len(lines), i+1+s.context)]...),
+			}
+			if !s.add(m) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// run searches with ripgrep or grep over SSH, and walks the tree over SFTP
+// when neither is available. Regular expressions are checked with Go's RE2
+// syntax, so grep is only used with -P, whose dialect is close enough; every
+// line is then matched again with s.matcher.
+func (s *searcher) run(ctx context.Context) (string, error) {
+	if remoteCommandExists("rg") {
+		err := s.runRemote(ctx, s.ripgrepCommand())
+		if err == nil || !isCommandUnavailable(err) {
+			return "ripgrep", err
+		}
+	}
+	if remoteCommandExists("grep") && remoteCommandExists("xargs") && remoteCommandExists("find") && (!s.regex || grepSupportsPCRE()) {
+		err := s.runRemote(ctx, s.grepCommand())
+		if err == nil || !isCommandUnavailable(err) {
+			return "grep", err
+		}
+	}
+	return "sftp", s.walkSFTP(ctx)
+}
+
+func grepSupportsPCRE() bool {
+	_, err := runRemoteCommand(`echo 1 | grep -qP '\d'`)
+	return err == nil
+}
+
+func writeEvent(w http.ResponseWriter, event string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// handleSearch streams matches as Server-Sent Events ("match"), followed by
+// a single "done" event carrying the totals or the error.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if server.sftpClient == nil {
+		writeEvent(w, "done", map[string]interface{}{"error": "Non connecté"})
+		return
+	}
+
+	s, err := newSearcher(r.URL.Query())
+	if err != nil {
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+		return
+	}
+	s.emit = func(m SearchMatch) {
+		writeEvent(w, "match", m)
+	}
+
+	backend, err := s.run(r.Context())
+	result := map[string]interface{}{
+		"count":     s.count,
+		"truncated": s.truncated,
+		"backend":   backend,
+	}
+	if err != nil {
+		result["error"] = fmt.Sprintf("Erreur: %v", err)
+	}
+	writeEvent(w, "done", result)
+}
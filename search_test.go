@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParseSearchLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		file  string
+		want  searchLine
+		valid bool
+	}{
+		{"a.go\x0012:func main() {", "a.go", searchLine{num: 12, text: "func main() {", match: true}, true},
+		{"a.go\x0013-\treturn", "a.go", searchLine{num: 13, text: "\treturn"}, true},
+		{"dir/b c.txt\x001:x:y", "dir/b c.txt", searchLine{num: 1, text: "x:y", match: true}, true},
+		{"--", "", searchLine{}, false},
+		{"a.go\x00:text", "", searchLine{}, false},
+		{"a.go\x0012", "", searchLine{}, false},
+	}
+
+	for _, tt := range tests {
+		file, got, ok := parseSearchLine(tt.line)
+		if ok != tt.valid || file != tt.file || got != tt.want {
+			t.Errorf("parseSearchLine(%q) = %q, %+v, %v; want %q, %+v, %v", tt.line, file, got, ok, tt.file, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestFlushBlockRefiltersRemoteMatches(t *testing.T) {
+	s, err := newSearcher(map[string][]string{"q": {`\d+`}, "regex": {"1"}, "path": {"/srv"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []SearchMatch
+	s.emit = func(m SearchMatch) { got = append(got, m) }
+
+	// A remote dialect without \d would report lines Go does not match.
+	s.flushBlock("/srv/a.txt", []searchLine{
+		{num: 1, text: "abc", match: true},
+		{num: 2, text: "line 42\r", match: true},
+		{num: 3, text: "ddd", match: true},
+	})
+
+	if len(got) != 1 || got[0].Line != 2 || got[0].Column != 6 {
+		t.Fatalf("flushBlock emitted %+v, want only line 2 at column 6", got)
+	}
+	if len(got[0].Before) != 1 || got[0].Before[0] != "abc" || len(got[0].After) != 1 || got[0].After[0] != "ddd" {
+		t.Errorf("context = %q / %q, want [abc] / [ddd]", got[0].Before, got[0].After)
+	}
+}
@@ -1,11 +1,21 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -18,8 +28,12 @@ type Server struct {
 	sshClient  *ssh.Client
 	sftpClient *sftp.Client
 	rootPath   string
+	host       string
 	useSudo    bool
 	password   string
+	watcher    *Watcher
+	index      *FileIndex
+	terminals  *TerminalSet
 }
 
 type FileNode struct {
@@ -47,16 +61,60 @@ type Response struct {
 
 var server *Server
 
+const missingVersion = "absent"
+
 func main() {
+	protected := flag.String("protected", strings.Join(protectedPaths, ","), "Chemins distants qui ne peuvent jamais être supprimés (séparés par des virgules)")
+	flag.Int64Var(&maxEditSize, "max-edit-size", maxEditSize, "Taille maximale (octets) d'un fichier ouvert en édition; au-delà il est affiché en lecture seule par pages")
+	flag.StringVar(&historyDir, "history-dir", historyDir, "Dossier local où est conservé l'historique des versions sauvegardées")
+	flag.IntVar(&historyMaxVersions, "history-max-versions", historyMaxVersions, "Nombre maximal de versions conservées par fichier (0 pour ne pas limiter)")
+	flag.Int64Var(&historyMaxBytes, "history-max-bytes", historyMaxBytes, "Taille totale maximale (octets) de l'historique; les versions les plus anciennes sont supprimées au-delà (0 pour ne pas limiter)")
+	flag.StringVar(&tasksDir, "tasks-dir", tasksDir, "Dossier local où sont conservées les tâches de chaque connexion et l'historique de leurs exécutions")
+	flag.StringVar(&syncRoot, "sync-root", syncRoot, "Dossier local dans lequel la synchronisation peut lire et écrire (désactivée si vide)")
+	flag.Parse()
+
+	protectedPaths = parsePathList(*protected)
 	server = &Server{}
 
 	http.HandleFunc("/", handleIndex)
 	http.HandleFunc("/api/connect", handleConnect)
 	http.HandleFunc("/api/tree", handleTree)
 	http.HandleFunc("/api/file", handleFile)
+	http.HandleFunc("/api/file/range", handleFileRange)
+	http.HandleFunc("/api/file/hex", handleFileHex)
+	http.HandleFunc("/api/raw", handleRaw)
+	http.HandleFunc("/api/watch", handleWatch)
+	http.HandleFunc("/api/watch/paths", handleWatchPaths)
+	http.HandleFunc("/api/history", handleHistory)
+	http.HandleFunc("/api/history/diff", handleHistoryDiff)
+	http.HandleFunc("/api/history/restore", handleHistoryRestore)
 	http.HandleFunc("/api/save", handleSave)
+	http.HandleFunc("/api/save/review", handleSaveReview)
+	http.HandleFunc("/api/merge", handleMerge)
 	http.HandleFunc("/api/create", handleCreate)
 	http.HandleFunc("/api/delete", handleDelete)
+	http.HandleFunc("/api/copy", handleCopy)
+	http.HandleFunc("/api/delete/preview", handleDeletePreview)
+	http.HandleFunc("/api/trash", handleTrash)
+	http.HandleFunc("/api/trash/restore", handleTrashRestore)
+	http.HandleFunc("/api/trash/purge", handleTrashPurge)
+	http.HandleFunc("/api/permissions", handlePermissions)
+	http.HandleFunc("/api/upload", handleUpload)
+	http.HandleFunc("/api/download", handleDownload)
+	http.HandleFunc("/api/search", handleSearch)
+	http.HandleFunc("/api/quickopen", handleQuickOpen)
+	http.HandleFunc("/api/replace/preview", handleReplacePreview)
+	http.HandleFunc("/api/replace/apply", handleReplaceApply)
+	http.HandleFunc("/api/compare", handleCompare)
+	http.HandleFunc("/api/sync", handleSync)
+	http.HandleFunc("/api/archive/create", handleArchiveCreate)
+	http.HandleFunc("/api/archive/extract", handleArchiveExtract)
+	http.HandleFunc("/api/terminal", handleTerminal)
+	http.HandleFunc("/api/tasks", handleTasks)
+	http.HandleFunc("/api/tasks/save", handleTasksSave)
+	http.HandleFunc("/api/tasks/run", handleTaskRun)
+	http.HandleFunc("/api/tasks/runs", handleTaskRuns)
+	http.HandleFunc("/api/tasks/runs/output", handleTaskRunOutput)
 
 	fmt.Println("🚀 SSH Code Editor démarré sur http://localhost:8080")
 	fmt.Println("📝 Ouvrez votre navigateur et accédez à cette adresse")
@@ -227,6 +285,13 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             color: var(--text-primary);
         }
         
+        .tree-item.drop-target,
+        #tree-container.drop-target {
+            outline: 1px dashed var(--accent);
+            outline-offset: -1px;
+            background: rgba(0, 122, 204, 0.15);
+        }
+        
         .tree-item .icon {
             width: 16px;
             text-align: center;
@@ -302,6 +367,30 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             border-color: var(--border-color);
         }
         
+        #pager {
+            background: var(--bg-secondary);
+            border-bottom: 1px solid var(--border-color);
+            padding: 6px 20px;
+            display: flex;
+            align-items: center;
+            gap: 8px;
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+        
+        #pager.hidden {
+            display: none;
+        }
+        
+        #pager input {
+            width: 100px;
+            padding: 4px 8px;
+        }
+        
+        #pager .spacer {
+            flex: 1;
+        }
+        
         #editor-wrapper {
             flex: 1;
             display: flex;
@@ -362,6 +451,53 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             overflow: hidden;
         }
         
+        /* MEDIA PREVIEW */
+        #media-preview {
+            position: absolute;
+            inset: 0;
+            display: flex;
+            flex-direction: column;
+            background: var(--bg-primary);
+        }
+        
+        #media-preview.hidden {
+            display: none;
+        }
+        
+        #media-toolbar {
+            display: flex;
+            justify-content: flex-end;
+            padding: 6px 20px;
+            border-bottom: 1px solid var(--border-color);
+        }
+        
+        #media-content {
+            flex: 1;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            overflow: auto;
+            padding: 20px;
+        }
+        
+        #media-content img {
+            max-width: 100%;
+            max-height: 100%;
+            background: repeating-conic-gradient(#2a2a2a 0% 25%, #333 0% 50%) 50% / 20px 20px;
+        }
+        
+        #media-content iframe {
+            width: 100%;
+            height: 100%;
+            border: none;
+            background: white;
+        }
+        
+        #media-content video {
+            max-width: 100%;
+            max-height: 100%;
+        }
+        
         /* STATUS BAR */
         #status-bar {
             background: var(--bg-secondary);
@@ -381,6 +517,35 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             gap: 8px;
         }
         
+        #format-info {
+            display: flex;
+            align-items: center;
+            gap: 8px;
+        }
+        
+        #format-info.hidden {
+            display: none;
+        }
+        
+        .status-item select {
+            background: transparent;
+            color: var(--text-secondary);
+            border: none;
+            font-size: 12px;
+            cursor: pointer;
+        }
+        
+        .status-item select option {
+            background: var(--bg-secondary);
+        }
+        
+        .status-item label {
+            display: flex;
+            align-items: center;
+            gap: 4px;
+            cursor: pointer;
+        }
+        
         /* BUTTONS */
         button {
             background: var(--bg-elevated);
@@ -576,408 +741,4104 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             flex: 1;
         }
         
-        /* CONTEXT MENU */
-        .context-menu {
-            position: fixed;
-            background: var(--bg-elevated);
-            border: 1px solid var(--border-color);
-            border-radius: 6px;
-            padding: 4px 0;
-            box-shadow: var(--shadow-lg);
-            z-index: 10000;
-            min-width: 180px;
+        .modal-content.wide {
+            width: 720px;
         }
         
-        .context-menu-item {
-            padding: 8px 16px;
-            cursor: pointer;
+        .hidden {
+            display: none;
+        }
+        
+        .perm-grid {
+            display: grid;
+            grid-template-columns: 90px repeat(3, 1fr);
+            gap: 6px 12px;
+            align-items: center;
             font-size: 13px;
+            margin-bottom: 16px;
+        }
+        
+        .perm-grid .head {
+            color: var(--text-secondary);
+            font-size: 11px;
+            text-transform: uppercase;
+        }
+        
+        .form-row {
             display: flex;
-            align-items: center;
-            gap: 10px;
-            transition: background 0.1s ease;
+            gap: 12px;
         }
         
-        .context-menu-item:hover {
-            background: var(--bg-tertiary);
+        .form-row .form-group {
+            flex: 1;
         }
         
-        .context-menu-item.danger {
+        /* DIFF */
+        .diff-view {
+            font-family: 'Consolas', 'Monaco', 'Courier New', monospace;
+            font-size: 12px;
+            line-height: 1.5;
+            white-space: pre;
+            overflow: auto;
+            max-height: 40vh;
+            background: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            padding: 8px 0;
+            margin-top: 12px;
+        }
+        
+        .diff-view div {
+            padding: 0 12px;
+        }
+        
+        .diff-view .add {
+            background: rgba(137, 209, 133, 0.15);
+            color: var(--success);
+        }
+        
+        .diff-view .del {
+            background: rgba(244, 135, 113, 0.15);
             color: var(--danger);
         }
         
-        .context-menu-divider {
-            height: 1px;
-            background: var(--border-color);
-            margin: 4px 0;
+        .diff-view .hunk {
+            color: var(--accent-hover);
         }
         
-        /* LOADING */
-        .loading {
-            display: inline-block;
-            width: 12px;
-            height: 12px;
-            border: 2px solid var(--border-color);
-            border-top-color: var(--accent);
-            border-radius: 50%;
-            animation: spin 0.8s linear infinite;
+        .diff-view .empty {
+            color: var(--text-muted);
         }
         
-        @keyframes spin {
-            to { transform: rotate(360deg); }
+        .side-diff {
+            display: grid;
+            grid-template-columns: auto 1fr auto 1fr;
+            font-family: 'Consolas', 'Monaco', 'Courier New', monospace;
+            font-size: 12px;
+            line-height: 1.5;
+            max-height: 50vh;
+            overflow: auto;
+            background: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
         }
         
-        /* NOTIFICATION */
-        .notification {
-            position: fixed;
-            top: 20px;
-            right: 20px;
-            background: var(--bg-elevated);
+        .side-diff span {
+            padding: 0 8px;
+            white-space: pre;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        
+        .side-diff .num {
+            color: var(--text-muted);
+            text-align: right;
+            user-select: none;
+        }
+        
+        .side-diff .del {
+            background: rgba(244, 135, 113, 0.15);
+        }
+        
+        .side-diff .add {
+            background: rgba(137, 209, 133, 0.15);
+        }
+        
+        .side-diff .skip {
+            grid-column: 1 / -1;
+            color: var(--accent-hover);
+            background: var(--bg-secondary);
+        }
+        
+        .list-section {
+            padding: 6px 12px;
+            background: var(--bg-secondary);
+            border-bottom: 1px solid var(--border-color);
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+        
+        /* LISTS */
+        .item-list {
+            max-height: 50vh;
+            overflow-y: auto;
             border: 1px solid var(--border-color);
-            padding: 14px 18px;
-            border-radius: 6px;
-            box-shadow: var(--shadow-lg);
-            z-index: 10000;
-            animation: slideInRight 0.3s ease;
-            max-width: 350px;
+            border-radius: 4px;
         }
         
-        @keyframes slideInRight {
-            from {
-                transform: translateX(400px);
-                opacity: 0;
-            }
-            to {
-                transform: translateX(0);
-                opacity: 1;
-            }
+        .item-list .empty {
+            padding: 16px;
+            color: var(--text-muted);
+            text-align: center;
         }
         
-        .notification.success {
-            border-left: 3px solid var(--success);
+        .list-row {
+            display: flex;
+            align-items: center;
+            gap: 10px;
+            padding: 8px 12px;
+            border-bottom: 1px solid var(--border-color);
+            font-size: 13px;
         }
         
-        .notification.error {
-            border-left: 3px solid var(--danger);
+        .list-row:last-child {
+            border-bottom: none;
         }
-    </style>
-</head>
-<body>
-    <div id="app">
-        <div id="header">
-            <button onclick="showConnectModal()">Nouveau projet SSH</button>
-            <button id="saveBtn" onclick="saveFile()" disabled class="primary">Sauvegarder</button>
-            <div class="spacer"></div>
-            <button onclick="disconnect()">Déconnecter</button>
-        </div>
         
-        <div id="content">
-            <div id="sidebar">
-                <div id="sidebar-header">
-                    <span>Explorateur</span>
-                    <div id="sidebar-actions">
-                        <button class="icon-btn" onclick="showCreateModal('file')" title="Nouveau fichier">+</button>
-                        <button class="icon-btn" onclick="showCreateModal('folder')" title="Nouveau dossier">□</button>
-                        <button class="icon-btn" onclick="loadTree()" title="Rafraîchir">↻</button>
-                    </div>
-                </div>
-                <div id="tree-container">
-                    <div id="tree"></div>
-                </div>
-            </div>
-            
-            <div id="editor-container">
-                <div id="editor-header">
-                    <div id="editor-tabs">
-                        <div class="editor-tab active">
-                            <span id="current-file">Aucun fichier ouvert</span>
-                        </div>
-                    </div>
-                    <span id="file-size" style="color: var(--text-muted); font-size: 12px;"></span>
-                </div>
-                <div id="editor-wrapper">
-                    <textarea id="editor" placeholder="Sélectionnez un fichier pour commencer..." spellcheck="false"></textarea>
-                </div>
-            </div>
-        </div>
+        .list-row .name {
+            flex: 1;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            white-space: nowrap;
+        }
         
-        <div id="status-bar">
-            <div class="status-item">
-                <span id="status-text">Prêt</span>
-            </div>
-            <div class="status-item">
-                <span id="connection-info"></span>
-                <span id="language-info"></span>
-            </div>
-        </div>
-    </div>
+        .list-row .meta {
+            color: var(--text-muted);
+            font-size: 12px;
+            white-space: nowrap;
+        }
+        
+        /* SEARCH */
+        .search-file {
+            padding: 6px 12px;
+            background: var(--bg-secondary);
+            border-bottom: 1px solid var(--border-color);
+            font-size: 12px;
+            color: var(--accent-hover);
+            position: sticky;
+            top: 0;
+        }
+        
+        .search-match {
+            font-family: 'Consolas', 'Monaco', 'Courier New', monospace;
+            font-size: 12px;
+            padding: 4px 12px;
+            border-bottom: 1px solid var(--border-color);
+            cursor: pointer;
+            white-space: pre;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        
+        .search-match:hover {
+            background: var(--bg-elevated);
+        }
+        
+        .search-match .context {
+            color: var(--text-muted);
+        }
+        
+        .search-match mark {
+            background: rgba(234, 179, 8, 0.35);
+            color: inherit;
+        }
+        
+        #searchSummary, #compareSummary, #reviewSummary, #syncSummary, #taskSummary {
+            font-size: 12px;
+            color: var(--text-muted);
+            margin: 8px 0;
+        }
+        
+        /* TERMINAL */
+        #terminal-panel {
+            height: 280px;
+            min-height: 80px;
+            display: flex;
+            flex-direction: column;
+            border-top: 1px solid var(--border-color);
+            background: var(--bg-primary);
+        }
+        
+        #terminal-panel.hidden {
+            display: none;
+        }
+        
+        #terminal-resizer {
+            height: 4px;
+            margin-top: -2px;
+            cursor: ns-resize;
+        }
+        
+        #terminal-header {
+            display: flex;
+            align-items: center;
+            gap: 4px;
+            padding: 0 8px;
+            background: var(--bg-secondary);
+            border-bottom: 1px solid var(--border-color);
+            height: 30px;
+        }
+        
+        #terminal-tabs {
+            display: flex;
+            gap: 2px;
+            flex: 1;
+            overflow-x: auto;
+        }
+        
+        .terminal-tab {
+            display: flex;
+            align-items: center;
+            gap: 6px;
+            padding: 4px 10px;
+            font-size: 12px;
+            color: var(--text-secondary);
+            border-radius: 3px;
+            cursor: pointer;
+            white-space: nowrap;
+        }
+        
+        .terminal-tab.active {
+            background: var(--bg-elevated);
+            color: var(--text-primary);
+        }
+        
+        .terminal-tab.exited {
+            color: var(--text-muted);
+        }
+        
+        .terminal-tab .close {
+            color: var(--text-muted);
+        }
+        
+        .terminal-tab .close:hover {
+            color: var(--text-primary);
+        }
+        
+        #terminal-body {
+            flex: 1;
+            position: relative;
+            overflow: hidden;
+        }
+        
+        .terminal-screen {
+            position: absolute;
+            inset: 0;
+            padding: 4px 8px;
+            overflow-y: auto;
+            outline: none;
+            font-family: 'Consolas', 'Monaco', 'Courier New', monospace;
+            font-size: 13px;
+            line-height: 1.25;
+            color: var(--text-primary);
+            white-space: pre;
+            cursor: text;
+        }
+        
+        .terminal-screen > div > div {
+            height: 1.25em;
+        }
+        
+        .terminal-screen .cursor {
+            outline: 1px solid var(--text-primary);
+        }
+        
+        .terminal-screen:focus .cursor {
+            background: var(--text-primary);
+            color: var(--bg-primary);
+        }
+        
+        /* TÂCHES */
+        #taskList, #taskRuns {
+            max-height: 25vh;
+            margin-bottom: 12px;
+        }
+        
+        .task-output {
+            min-height: 120px;
+            max-height: 40vh;
+            overflow: auto;
+            margin-bottom: 12px;
+            padding: 8px 12px;
+            background: var(--bg-primary);
+            border: 1px solid var(--border-color);
+            border-radius: 4px;
+            font-family: 'Consolas', 'Monaco', 'Courier New', monospace;
+            font-size: 12px;
+            white-space: pre-wrap;
+            word-break: break-all;
+        }
+        
+        .task-output .stderr {
+            color: var(--danger);
+        }
+        
+        /* ARCHIVES */
+        .progress-bar {
+            height: 6px;
+            margin: 12px 0 8px;
+            background: var(--bg-primary);
+            border-radius: 3px;
+            overflow: hidden;
+        }
+        
+        .progress-bar div {
+            width: 0;
+            height: 100%;
+            background: var(--accent);
+            transition: width 0.1s;
+        }
+        
+        #archiveCurrent, #archiveCount {
+            font-size: 12px;
+            color: var(--text-muted);
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        
+        /* QUICK OPEN */
+        .modal.palette {
+            align-items: flex-start;
+            padding-top: 12vh;
+            background: rgba(0,0,0,0.4);
+            backdrop-filter: none;
+        }
+        
+        .palette .modal-content {
+            width: 600px;
+            padding: 8px;
+        }
+        
+        .palette input {
+            width: 100%;
+            padding: 8px 10px;
+            background: var(--bg-primary);
+            color: var(--text-primary);
+            border: 1px solid var(--border-focus);
+            border-radius: 2px;
+            font-size: 14px;
+            outline: none;
+        }
+        
+        #quickOpenList {
+            max-height: 50vh;
+            overflow-y: auto;
+            margin-top: 6px;
+        }
+        
+        #quickOpenList .empty {
+            padding: 10px;
+            color: var(--text-muted);
+            font-size: 13px;
+        }
+        
+        .quick-item {
+            display: flex;
+            align-items: baseline;
+            gap: 10px;
+            padding: 5px 10px;
+            font-size: 13px;
+            cursor: pointer;
+            border-radius: 2px;
+        }
+        
+        .quick-item.active {
+            background: var(--accent-dark);
+        }
+        
+        .quick-item .dir {
+            color: var(--text-muted);
+            font-size: 12px;
+            overflow: hidden;
+            text-overflow: ellipsis;
+            white-space: nowrap;
+        }
+        
+        .quick-item b {
+            color: var(--accent-hover);
+        }
+        
+        .quick-item.active b {
+            color: #fff;
+        }
+        
+        /* CONTEXT MENU */
+        .context-menu {
+            position: fixed;
+            background: var(--bg-elevated);
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            padding: 4px 0;
+            box-shadow: var(--shadow-lg);
+            z-index: 10000;
+            min-width: 180px;
+        }
+        
+        .context-menu-item {
+            padding: 8px 16px;
+            cursor: pointer;
+            font-size: 13px;
+            display: flex;
+            align-items: center;
+            gap: 10px;
+            transition: background 0.1s ease;
+        }
+        
+        .context-menu-item:hover {
+            background: var(--bg-tertiary);
+        }
+        
+        .context-menu-item.danger {
+            color: var(--danger);
+        }
+        
+        .context-menu-divider {
+            height: 1px;
+            background: var(--border-color);
+            margin: 4px 0;
+        }
+        
+        /* LOADING */
+        .loading {
+            display: inline-block;
+            width: 12px;
+            height: 12px;
+            border: 2px solid var(--border-color);
+            border-top-color: var(--accent);
+            border-radius: 50%;
+            animation: spin 0.8s linear infinite;
+        }
+        
+        @keyframes spin {
+            to { transform: rotate(360deg); }
+        }
+        
+        /* NOTIFICATION */
+        .notification {
+            position: fixed;
+            top: 20px;
+            right: 20px;
+            background: var(--bg-elevated);
+            border: 1px solid var(--border-color);
+            padding: 14px 18px;
+            border-radius: 6px;
+            box-shadow: var(--shadow-lg);
+            z-index: 10000;
+            animation: slideInRight 0.3s ease;
+            max-width: 350px;
+        }
+        
+        @keyframes slideInRight {
+            from {
+                transform: translateX(400px);
+                opacity: 0;
+            }
+            to {
+                transform: translateX(0);
+                opacity: 1;
+            }
+        }
+        
+        .notification.success {
+            border-left: 3px solid var(--success);
+        }
+        
+        .notification.error {
+            border-left: 3px solid var(--danger);
+        }
+    </style>
+</head>
+<body>
+    <div id="app">
+        <div id="header">
+            <button onclick="showConnectModal()">Nouveau projet SSH</button>
+            <button id="saveBtn" onclick="saveFile()" disabled class="primary">Sauvegarder</button>
+            <button id="reviewBtn" onclick="showReviewModal()" disabled>Vérifier</button>
+            <button id="historyBtn" onclick="showHistoryModal()" disabled>Historique</button>
+            <button onclick="toggleTerminalPanel()" title="Terminal (Ctrl+J)">Terminal</button>
+            <button onclick="showTasksModal()">Tâches</button>
+            <div class="spacer"></div>
+            <button onclick="disconnect()">Déconnecter</button>
+        </div>
+        
+        <div id="content">
+            <div id="sidebar">
+                <div id="sidebar-header">
+                    <span>Explorateur</span>
+                    <div id="sidebar-actions">
+                        <button class="icon-btn" onclick="showCreateModal('file')" title="Nouveau fichier">+</button>
+                        <button class="icon-btn" onclick="showCreateModal('folder')" title="Nouveau dossier">□</button>
+                        <button class="icon-btn" onclick="loadTree()" title="Rafraîchir">↻</button>
+                        <button class="icon-btn" onclick="chooseUpload('', false)" title="Téléverser des fichiers">⇪</button>
+                        <button class="icon-btn" onclick="showTrashModal()" title="Corbeille">♲</button>
+                        <button class="icon-btn" onclick="showSearchModal()" title="Rechercher dans les fichiers (Ctrl+Maj+F)">⌕</button>
+                        <button class="icon-btn" onclick="showQuickOpen()" title="Ouvrir un fichier (Ctrl+P)">⇢</button>
+                    </div>
+                </div>
+                <div id="tree-container">
+                    <div id="tree"></div>
+                </div>
+                <input type="file" id="uploadInput" multiple hidden>
+                <input type="file" id="uploadFolderInput" webkitdirectory hidden>
+            </div>
+            
+            <div id="editor-container">
+                <div id="editor-header">
+                    <div id="editor-tabs">
+                        <div class="editor-tab active">
+                            <span id="current-file">Aucun fichier ouvert</span>
+                        </div>
+                    </div>
+                    <span id="file-size" style="color: var(--text-muted); font-size: 12px;"></span>
+                </div>
+                <div id="pager" class="hidden">
+                    <span id="pager-info"></span>
+                    <div class="spacer"></div>
+                    <button onclick="viewerFirst()">⇤ Début</button>
+                    <button id="pager-prev" onclick="viewerPrev()">‹ Précédent</button>
+                    <button id="pager-next" onclick="viewerNext()">Suivant ›</button>
+                    <button onclick="viewerLast()">Fin ⇥</button>
+                    <input type="text" id="pager-goto" placeholder="Ligne / offset">
+                    <button onclick="viewerGoto()">Aller</button>
+                </div>
+                <div id="editor-wrapper">
+                    <textarea id="editor" placeholder="Sélectionnez un fichier pour commencer..." spellcheck="false"></textarea>
+                    <div id="media-preview" class="hidden">
+                        <div id="media-toolbar">
+                            <button id="media-as-text" onclick="loadFile(currentFile, true)">Ouvrir comme texte</button>
+                        </div>
+                        <div id="media-content"></div>
+                    </div>
+                </div>
+                <div id="terminal-panel" class="hidden">
+                    <div id="terminal-resizer"></div>
+                    <div id="terminal-header">
+                        <div id="terminal-tabs"></div>
+                        <button class="icon-btn" onclick="openTerminal(selectedFolder)" title="Nouveau terminal">+</button>
+                        <button class="icon-btn" onclick="toggleTerminalPanel()" title="Masquer (Ctrl+J)">⌄</button>
+                    </div>
+                    <div id="terminal-body"></div>
+                </div>
+            </div>
+        </div>
+        
+        <div id="status-bar">
+            <div class="status-item">
+                <span id="status-text">Prêt</span>
+            </div>
+            <div class="status-item">
+                <span id="connection-info"></span>
+                <span id="format-info" class="hidden">
+                    <select id="encodingSelect" title="Encodage" onchange="changeFormat()">
+                        <option value="utf-8">UTF-8</option>
+                        <option value="utf-16le">UTF-16 LE</option>
+                        <option value="utf-16be">UTF-16 BE</option>
+                        <option value="iso-8859-1">ISO-8859-1</option>
+                        <option value="windows-1252">Windows-1252</option>
+                    </select>
+                    <label title="Marque d'ordre des octets"><input type="checkbox" id="bomCheck" onchange="changeFormat()"> BOM</label>
+                    <select id="eolSelect" title="Fins de ligne" onchange="changeFormat()">
+                        <option value="lf">LF</option>
+                        <option value="crlf">CRLF</option>
+                        <option value="cr">CR</option>
+                    </select>
+                </span>
+                <span id="language-info"></span>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Connexion -->
+    <div id="connectModal" class="modal hidden">
+        <div class="modal-content">
+            <div class="modal-header">
+                <h2>Connexion SSH</h2>
+                <button class="modal-close" onclick="hideConnectModal()">×</button>
+            </div>
+            <div class="form-group">
+                <label>Type</label>
+                <select id="type">
+                    <option value="true">Dossier</option>
+                    <option value="false">Fichier</option>
+                </select>
+            </div>
+            <div class="form-group checkbox">
+                <input type="checkbox" id="useSudo">
+                <label for="useSudo">Utiliser sudo (fichiers système)</label>
+            </div>
+            <div class="form-group">
+                <label>Hôte</label>
+                <input type="text" id="host" placeholder="192.168.1.100">
+            </div>
+            <div class="form-group">
+                <label>Port</label>
+                <input type="text" id="port" value="22">
+            </div>
+            <div class="form-group">
+                <label>Utilisateur</label>
+                <input type="text" id="username" placeholder="root">
+            </div>
+            <div class="form-group">
+                <label>Mot de passe</label>
+                <input type="password" id="password">
+            </div>
+            <div class="form-group">
+                <label>Chemin</label>
+                <input type="text" id="path" placeholder="/root/project">
+            </div>
+            <div class="form-buttons">
+                <button onclick="hideConnectModal()">Annuler</button>
+                <button onclick="connect()" class="primary">Connecter</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Création -->
+    <div id="createModal" class="modal hidden">
+        <div class="modal-content">
+            <div class="modal-header">
+                <h2 id="createTitle">Nouveau fichier</h2>
+                <button class="modal-close" onclick="hideCreateModal()">×</button>
+            </div>
+            <div class="form-group">
+                <label>Dossier parent</label>
+                <input type="text" id="createParent">
+            </div>
+            <div class="form-group">
+                <label>Nom</label>
+                <input type="text" id="createName" placeholder="fichier.txt ou sous/dossier/fichier.txt">
+            </div>
+            <div class="form-group">
+                <label>Mode (optionnel)</label>
+                <input type="text" id="createMode" placeholder="0644">
+            </div>
+            <div class="form-buttons">
+                <button onclick="hideCreateModal()">Annuler</button>
+                <button onclick="createItem()" class="primary">Créer</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Corbeille -->
+    <div id="trashModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2>Corbeille</h2>
+                <button class="modal-close" onclick="hideTrashModal()">×</button>
+            </div>
+            <div id="trashList" class="item-list"></div>
+            <div class="form-buttons">
+                <button onclick="hideTrashModal()">Fermer</button>
+                <button onclick="purgeTrash('')" class="danger">Vider la corbeille</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Historique -->
+    <div id="historyModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2 id="historyTitle">Historique</h2>
+                <button class="modal-close" onclick="hideHistoryModal()">×</button>
+            </div>
+            <div id="historyList" class="item-list"></div>
+            <div id="historyDiff" class="diff-view hidden"></div>
+            <div class="form-buttons">
+                <button onclick="hideHistoryModal()">Fermer</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Ouverture rapide -->
+    <div id="quickOpenModal" class="modal palette hidden" onclick="if (event.target === this) hideQuickOpen()">
+        <div class="modal-content">
+            <input type="text" id="quickOpenInput" placeholder="Rechercher un fichier par nom..." autocomplete="off">
+            <div id="quickOpenList"></div>
+        </div>
+    </div>
+
+    <!-- Modal Recherche -->
+    <div id="searchModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2>Rechercher dans les fichiers</h2>
+                <button class="modal-close" onclick="hideSearchModal()">×</button>
+            </div>
+            <div class="form-group">
+                <label>Rechercher</label>
+                <input type="text" id="searchQuery" placeholder="texte ou expression régulière">
+            </div>
+            <div class="form-group">
+                <label>Remplacer par</label>
+                <input type="text" id="replaceWith" placeholder="texte de remplacement ($1 pour un groupe en mode regex)">
+            </div>
+            <div class="form-row">
+                <div class="form-group">
+                    <label>Exclure</label>
+                    <input type="text" id="searchIgnore" value=".git, .svn, .hg, node_modules, __pycache__, .ssh-editor-trash">
+                </div>
+                <div class="form-group">
+                    <label>Taille max (Ko)</label>
+                    <input type="text" id="searchMaxSize" value="1024">
+                </div>
+            </div>
+            <div class="form-row">
+                <div class="form-group checkbox">
+                    <input type="checkbox" id="searchRegex">
+                    <label for="searchRegex">Expression régulière</label>
+                </div>
+                <div class="form-group checkbox">
+                    <input type="checkbox" id="searchCase">
+                    <label for="searchCase">Respecter la casse</label>
+                </div>
+            </div>
+            <div id="searchSummary"></div>
+            <div id="searchResults" class="item-list"></div>
+            <div class="form-buttons">
+                <button onclick="hideSearchModal()">Fermer</button>
+                <button id="searchStopBtn" onclick="stopSearch()" disabled>Arrêter</button>
+                <button onclick="previewReplace()">Remplacer...</button>
+                <button onclick="startSearch()" class="primary">Rechercher</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Remplacement -->
+    <div id="replaceModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2 id="replaceTitle">Remplacer</h2>
+                <button class="modal-close" onclick="hideReplaceModal()">×</button>
+            </div>
+            <div id="replaceList" class="item-list"></div>
+            <div id="replaceDiff" class="diff-view hidden"></div>
+            <div class="form-buttons">
+                <button onclick="hideReplaceModal()">Annuler</button>
+                <button id="replaceApplyBtn" onclick="applyReplace()" class="primary">Appliquer</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Comparaison -->
+    <div id="compareModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2>Comparer</h2>
+                <button class="modal-close" onclick="hideCompareModal()">×</button>
+            </div>
+            <div class="form-row">
+                <div class="form-group">
+                    <label>Gauche</label>
+                    <input type="text" id="compareLeft">
+                </div>
+                <div class="form-group">
+                    <label>Droite</label>
+                    <input type="text" id="compareRight">
+                </div>
+            </div>
+            <div class="form-row">
+                <div class="form-group checkbox">
+                    <input type="checkbox" id="compareRemote" onchange="document.getElementById('compareRemoteFields').classList.toggle('hidden', !this.checked)">
+                    <label for="compareRemote">Droite sur un autre serveur</label>
+                </div>
+                <div class="form-group">
+                    <select id="compareFormat">
+                        <option value="unified">Diff unifié</option>
+                        <option value="side">Côte à côte</option>
+                    </select>
+                </div>
+            </div>
+            <div id="compareRemoteFields" class="form-row hidden">
+                <div class="form-group">
+                    <label>Hôte</label>
+                    <input type="text" id="compareHost" placeholder="192.168.1.100">
+                </div>
+                <div class="form-group">
+                    <label>Port</label>
+                    <input type="text" id="comparePort" value="22">
+                </div>
+                <div class="form-group">
+                    <label>Utilisateur</label>
+                    <input type="text" id="compareUser">
+                </div>
+                <div class="form-group">
+                    <label>Mot de passe</label>
+                    <input type="password" id="comparePassword">
+                </div>
+            </div>
+            <div id="compareSummary"></div>
+            <div id="compareResult"></div>
+            <div class="form-buttons">
+                <button id="compareBackBtn" onclick="compareBack()" class="hidden">← Retour au dossier</button>
+                <button onclick="hideCompareModal()">Fermer</button>
+                <button onclick="runCompare()" class="primary">Comparer</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Vérification -->
+    <div id="reviewModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2 id="reviewTitle">Modifications à sauvegarder</h2>
+                <button class="modal-close" onclick="hideReviewModal()">×</button>
+            </div>
+            <div id="reviewSummary"></div>
+            <div id="reviewDiff" class="diff-view"></div>
+            <div class="form-buttons">
+                <button onclick="hideReviewModal()">Fermer</button>
+                <button onclick="saveFromReview()" class="primary">Sauvegarder</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Synchronisation -->
+    <div id="syncModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2>Synchroniser avec un dossier local</h2>
+                <button class="modal-close" onclick="hideSyncModal()">×</button>
+            </div>
+            <div class="form-row">
+                <div class="form-group">
+                    <label>Dossier local</label>
+                    <input type="text" id="syncLocal" placeholder="site ou /home/moi/site">
+                </div>
+                <div class="form-group">
+                    <label>Dossier distant</label>
+                    <input type="text" id="syncRemote">
+                </div>
+            </div>
+            <div class="form-row">
+                <div class="form-group">
+                    <label>Mode</label>
+                    <select id="syncMode">
+                        <option value="push">Envoyer (local → serveur)</option>
+                        <option value="pull">Récupérer (serveur → local)</option>
+                        <option value="mirror">Miroir (supprime sur le serveur ce qui n'est pas en local)</option>
+                    </select>
+                </div>
+                <div class="form-group">
+                    <label>Détection des changements</label>
+                    <select id="syncCompare">
+                        <option value="mtime">Taille et date</option>
+                        <option value="size">Taille</option>
+                        <option value="checksum">Somme de contrôle</option>
+                    </select>
+                </div>
+            </div>
+            <div class="form-group">
+                <label>Exclure</label>
+                <input type="text" id="syncIgnore" value=".git, .svn, .hg, node_modules, __pycache__, .ssh-editor-trash">
+            </div>
+            <div id="syncSummary"></div>
+            <div id="syncList" class="item-list hidden"></div>
+            <div class="form-buttons">
+                <button onclick="hideSyncModal()">Fermer</button>
+                <button onclick="runSync(true)">Simuler</button>
+                <button onclick="runSync(false)" class="primary">Synchroniser</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Tâches -->
+    <div id="tasksModal" class="modal hidden">
+        <div class="modal-content wide">
+            <div class="modal-header">
+                <h2>Tâches</h2>
+                <button class="modal-close" onclick="hideTasksModal()">×</button>
+            </div>
+            <div id="taskList" class="item-list"></div>
+            <div class="form-row">
+                <div class="form-group">
+                    <label>Nom</label>
+                    <input type="text" id="taskName" placeholder="build">
+                </div>
+                <div class="form-group">
+                    <label>Commande</label>
+                    <input type="text" id="taskCommand" placeholder="make build">
+                </div>
+                <div class="form-group">
+                    <label>Dossier</label>
+                    <input type="text" id="taskDir" placeholder="relatif au projet">
+                </div>
+            </div>
+            <div class="form-group checkbox">
+                <input type="checkbox" id="taskSudo">
+                <label for="taskSudo">Exécuter avec sudo</label>
+            </div>
+            <div class="form-buttons">
+                <button onclick="addTask()">Ajouter à la connexion</button>
+            </div>
+            <div id="taskSummary"></div>
+            <pre id="taskOutput" class="task-output hidden"></pre>
+            <div id="taskRuns" class="item-list"></div>
+            <div class="form-buttons">
+                <button onclick="hideTasksModal()">Fermer</button>
+                <button id="taskStopBtn" onclick="stopTask()" class="danger" disabled>Arrêter</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Archive -->
+    <div id="archiveModal" class="modal hidden">
+        <div class="modal-content">
+            <div class="modal-header">
+                <h2 id="archiveTitle">Archive</h2>
+                <button class="modal-close" onclick="stopArchiveTask()">×</button>
+            </div>
+            <div class="progress-bar"><div id="archiveProgress"></div></div>
+            <div id="archiveCount"></div>
+            <div id="archiveCurrent"></div>
+            <div class="form-buttons">
+                <button id="archiveStopBtn" onclick="stopArchiveTask()">Annuler</button>
+            </div>
+        </div>
+    </div>
+
+    <!-- Modal Permissions -->
+    <div id="permModal" class="modal hidden">
+        <div class="modal-content">
+            <div class="modal-header">
+                <h2>Permissions</h2>
+                <button class="modal-close" onclick="hidePermModal()">×</button>
+            </div>
+            <div class="form-group">
+                <label id="permPath"></label>
+            </div>
+            <div class="perm-grid" id="permGrid">
+                <span></span><span class="head">Lecture</span><span class="head">Écriture</span><span class="head">Exécution</span>
+                <span>Propriétaire</span><input type="checkbox" data-bit="256"><input type="checkbox" data-bit="128"><input type="checkbox" data-bit="64">
+                <span>Groupe</span><input type="checkbox" data-bit="32"><input type="checkbox" data-bit="16"><input type="checkbox" data-bit="8">
+                <span>Autres</span><input type="checkbox" data-bit="4"><input type="checkbox" data-bit="2"><input type="checkbox" data-bit="1">
+            </div>
+            <div class="form-row">
+                <div class="form-group">
+                    <label>Mode</label>
+                    <input type="text" id="permMode" placeholder="0644">
+                </div>
+                <div class="form-group">
+                    <label>Propriétaire</label>
+                    <input type="text" id="permOwner">
+                </div>
+                <div class="form-group">
+                    <label>Groupe</label>
+                    <input type="text" id="permGroup">
+                </div>
+            </div>
+            <div class="form-group checkbox" id="permRecursiveGroup">
+                <input type="checkbox" id="permRecursive">
+                <label for="permRecursive">Appliquer récursivement</label>
+            </div>
+            <div class="form-buttons">
+                <button onclick="hidePermModal()">Annuler</button>
+                <button onclick="applyPermissions()" class="primary">Appliquer</button>
+            </div>
+        </div>
+    </div>
+
+    <script>
+        let currentFile = '';
+        let expandedFolders = new Set();
+        let createType = 'file';
+        let contextMenuTarget = null;
+        let permTarget = null;
+        let selectedFolder = '';
+        let uploadTarget = '';
+        let viewer = null;
+        let changeEvents = null;
+        let searchEvents = null;
+        let replacePreview = null;
+        let compareParent = null;
+        let quickOpenResults = [];
+        let quickOpenActive = 0;
+        let quickOpenTimer = null;
+        let quickOpenSeq = 0;
+        let dirty = false;
+        let currentVersion = '';
+        let currentFormat = null;
+        let baseContent = '';
+        let lastSaveAt = 0;
+        let treeRefreshTimer = null;
+        let reloadTimer = null;
+        const VIEWER_LINES = 1000;
+        const VIEWER_TAIL_BYTES = 256 * 1024;
+        const HEX_PAGE_BYTES = 4096;
+
+        // CONNEXION
+        function showConnectModal() {
+            document.getElementById('connectModal').classList.remove('hidden');
+        }
+
+        function hideConnectModal() {
+            document.getElementById('connectModal').classList.add('hidden');
+        }
+
+        async function connect() {
+            const data = {
+                host: document.getElementById('host').value,
+                port: document.getElementById('port').value,
+                username: document.getElementById('username').value,
+                password: document.getElementById('password').value,
+                path: document.getElementById('path').value,
+                isDir: document.getElementById('type').value === 'true',
+                useSudo: document.getElementById('useSudo').checked
+            };
+
+            if (!data.host || !data.username || !data.password || !data.path) {
+                showNotification('Tous les champs sont requis', 'error');
+                return;
+            }
+
+            updateStatus('Connexion...', true);
+            
+            try {
+                const res = await fetch('/api/connect', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify(data)
+                });
+                const result = await res.json();
+                
+                if (result.success) {
+                    hideConnectModal();
+                    closeAllTerminals();
+                    document.getElementById('connection-info').textContent = data.username + '@' + data.host;
+                    showNotification('Connecté avec succès', 'success');
+                    updateStatus('Connecté');
+                    loadTree();
+                    startWatching();
+                } else {
+                    showNotification(result.message, 'error');
+                    updateStatus('Échec');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+                updateStatus('Erreur');
+            }
+        }
+
+        // ARBORESCENCE
+        async function loadTree() {
+            updateStatus('Chargement...', true);
+            const res = await fetch('/api/tree');
+            const result = await res.json();
+            if (result.success) {
+                renderTree(result.data, document.getElementById('tree'));
+                updateStatus('Prêt');
+            } else {
+                updateStatus('Erreur');
+            }
+        }
+
+        function renderTree(nodes, container) {
+            container.innerHTML = '';
+            nodes.forEach(node => {
+                renderNode(node, container, 0);
+            });
+        }
+
+        function renderNode(node, container, level) {
+            const div = document.createElement('div');
+            div.className = 'tree-item ' + (node.isDir ? 'folder' : 'file');
+            div.style.paddingLeft = (level * 16 + 12) + 'px';
+            div.dataset.path = node.path;
+            div.dataset.isDir = node.isDir;
+            
+            if (node.isDir) {
+                div.classList.add(expandedFolders.has(node.path) ? 'expanded' : 'collapsed');
+            }
+            
+            const icon = document.createElement('span');
+            icon.className = 'icon';
+            if (!node.isDir) {
+                icon.textContent = getFileIcon(node.name);
+            }
+            div.appendChild(icon);
+            
+            const name = document.createElement('span');
+            name.className = 'name';
+            name.textContent = node.name;
+            div.appendChild(name);
+            
+            div.onclick = (e) => {
+                e.stopPropagation();
+                if (node.isDir) {
+                    toggleFolder(node.path);
+                } else {
+                    loadFile(node.path);
+                }
+            };
+            
+            div.oncontextmenu = (e) => {
+                e.preventDefault();
+                showContextMenu(e, node.path, node.isDir);
+            };
+            
+            if (node.isDir) {
+                div.ondragover = (e) => {
+                    e.preventDefault();
+                    e.stopPropagation();
+                    div.classList.add('drop-target');
+                };
+                div.ondragleave = () => div.classList.remove('drop-target');
+                div.ondrop = (e) => {
+                    e.preventDefault();
+                    e.stopPropagation();
+                    div.classList.remove('drop-target');
+                    dropUpload(e, node.path);
+                };
+            }
+            
+            container.appendChild(div);
+            
+            if (node.isDir && node.children && expandedFolders.has(node.path)) {
+                const childContainer = document.createElement('div');
+                childContainer.className = 'tree-children';
+                node.children.forEach(child => {
+                    renderNode(child, childContainer, level + 1);
+                });
+                container.appendChild(childContainer);
+            }
+        }
+
+        function expandAncestors(path) {
+            const parts = path.split('/');
+            for (let i = 2; i < parts.length; i++) {
+                expandedFolders.add(parts.slice(0, i).join('/'));
+            }
+        }
+
+        function toggleFolder(path) {
+            selectedFolder = path;
+            if (expandedFolders.has(path)) {
+                expandedFolders.delete(path);
+            } else {
+                expandedFolders.add(path);
+            }
+            loadTree();
+            updateWatch();
+        }
+
+        function getFileIcon(filename) {
+            const ext = filename.split('.').pop().toLowerCase();
+            const icons = {
+                'js': '≡', 'json': '{ }', 'html': '< >', 'css': '#',
+                'py': 'py', 'go': 'go', 'java': 'j', 'php': 'php',
+                'md': 'md', 'txt': 'txt', 'pdf': 'pdf', 'zip': 'zip',
+                'jpg': 'img', 'png': 'img', 'gif': 'img', 'svg': 'svg',
+                'mp3': '♪', 'mp4': '▶', 'sh': 'sh', 'log': 'log'
+            };
+            return icons[ext] || '•';
+        }
+
+        // FICHIERS
+        async function loadFile(path, asText) {
+            if (!asText && previewKind(path)) {
+                showMediaPreview(path);
+                return;
+            }
+            hideMediaPreview();
+            updateStatus('Chargement...', true);
+            
+            try {
+                const res = await fetch('/api/file?path=' + encodeURIComponent(path));
+                const result = await res.json();
+                
+                if (result.success) {
+                    currentFile = path;
+                    selectedFolder = path.substring(0, path.lastIndexOf('/')) || '/';
+                    const editor = document.getElementById('editor');
+                    editor.value = result.data.content;
+                    baseContent = result.data.content || '';
+                    editor.readOnly = !!result.data.readOnly;
+                    currentVersion = result.data.version || '';
+                    dirty = false;
+                    showFormat(result.data.readOnly ? null : result.data.format);
+                    closeViewer();
+                    updateWatch();
+                    
+                    document.getElementById('current-file').textContent = path.split('/').pop() + (result.data.readOnly ? ' (lecture seule)' : '');
+                    document.getElementById('file-size').textContent = formatBytes(result.data.size);
+                    document.getElementById('saveBtn').disabled = !!result.data.readOnly;
+                    document.getElementById('reviewBtn').disabled = !!result.data.readOnly;
+                    document.getElementById('historyBtn').disabled = !!result.data.readOnly;
+                    
+                    if (currentFormat && currentFormat.mixedEol) {
+                        showNotification('Fins de ligne mixtes : elles seront unifiées en ' + currentFormat.eol.toUpperCase() + ' à la sauvegarde', 'error');
+                    }
+                    
+                    if (result.data.reason === 'binary') {
+                        showNotification('Fichier binaire : affichage hexadécimal en lecture seule', 'success');
+                        openViewer(path, result.data.size, 'hex');
+                    } else if (result.data.reason === 'large') {
+                        showNotification('Fichier trop volumineux pour l\'édition (> ' + formatBytes(result.data.limit) + '), affichage en lecture seule', 'success');
+                        openViewer(path, result.data.size);
+                    }
+                    
+                    const lang = detectLanguage(path);
+                    document.getElementById('language-info').textContent = lang.toUpperCase();
+                    
+                    updateStatus(path);
+                    
+                    document.querySelectorAll('.tree-item').forEach(el => {
+                        el.classList.remove('selected');
+                        if (el.dataset.path === path) {
+                            el.classList.add('selected');
+                        }
+                    });
+                } else {
+                    showNotification(result.message, 'error');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        async function saveFile(version) {
+            if (!currentFile || document.getElementById('editor').readOnly) return;
+            
+            const content = document.getElementById('editor').value;
+            if (hasConflictMarkers(content) && !confirm('Le fichier contient encore des marqueurs de conflit. Sauvegarder quand même ?')) return;
+            
+            updateStatus('Sauvegarde...', true);
+            
+            try {
+                const res = await fetch('/api/save', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        path: currentFile,
+                        content: content,
+                        version: version || currentVersion,
+                        format: currentFormat
+                    })
+                });
+                const result = await res.json();
+                
+                if (result.success) {
+                    dirty = false;
+                    lastSaveAt = Date.now();
+                    currentVersion = result.data.version;
+                    baseContent = content;
+                    showNotification('Fichier sauvegardé', 'success');
+                    updateStatus('Sauvegardé');
+                    setTimeout(() => updateStatus(currentFile), 2000);
+                } else if (result.data && result.data.conflict) {
+                    updateStatus('Conflit');
+                    resolveSaveConflict(result.message, result.data);
+                } else {
+                    showNotification(result.message, 'error');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function resolveSaveConflict(message, remote) {
+            const detail = remote.deleted ? 'Le fichier a été supprimé sur le serveur.' : message + '.';
+            if (!remote.deleted && confirm(detail + '\n\nOK : fusionner vos modifications avec la version du serveur\nAnnuler : autres choix')) {
+                mergeWithRemote();
+                return;
+            }
+            if (confirm(detail + '\n\nOK : écraser avec votre version\nAnnuler : conserver la version du serveur')) {
+                saveFile(remote.version);
+                return;
+            }
+            if (!remote.deleted && confirm('Remplacer le contenu de l\'éditeur par la version du serveur ? Vos modifications seront perdues.')) {
+                document.getElementById('editor').value = remote.content;
+                baseContent = remote.content;
+                currentVersion = remote.version;
+                showFormat(remote.format);
+                dirty = false;
+                updateStatus(currentFile);
+            }
+        }
+
+        // FUSION À TROIS VOIES
+        function hasConflictMarkers(text) {
+            return /^<<<<<<< /m.test(text) && /^>>>>>>> /m.test(text);
+        }
+
+        async function mergeWithRemote() {
+            updateStatus('Fusion...', true);
+            
+            try {
+                const res = await fetch('/api/merge', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        path: currentFile,
+                        base: baseContent,
+                        content: document.getElementById('editor').value
+                    })
+                });
+                const result = await res.json();
+                
+                if (!result.success) {
+                    updateStatus('Conflit');
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                const editor = document.getElementById('editor');
+                editor.value = result.data.content;
+                baseContent = result.data.remote;
+                currentVersion = result.data.version;
+                dirty = true;
+                
+                if (result.data.conflicts > 0) {
+                    updateStatus(currentFile + ' (' + result.message + ')');
+                    showNotification(result.message + ' : éditez les blocs <<<<<<< / >>>>>>> puis sauvegardez', 'error');
+                    const first = editor.value.search(/^<<<<<<< /m);
+                    const lineNumber = editor.value.substring(0, first).split('\n').length;
+                    goToLine(lineNumber, 1);
+                } else {
+                    updateStatus(currentFile + ' (fusionné, non sauvegardé)');
+                    showNotification(result.message + ', vérifiez puis sauvegardez', 'success');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        // ENCODAGE ET FINS DE LIGNE
+        function showFormat(format) {
+            currentFormat = format ? { encoding: format.encoding, bom: format.bom, eol: format.eol, mixedEol: format.mixedEol } : null;
+            document.getElementById('format-info').classList.toggle('hidden', !currentFormat);
+            if (!currentFormat) return;
+            document.getElementById('encodingSelect').value = currentFormat.encoding;
+            document.getElementById('eolSelect').value = currentFormat.eol;
+            document.getElementById('bomCheck').checked = currentFormat.bom;
+            updateBomState();
+        }
+
+        function updateBomState() {
+            const encoding = document.getElementById('encodingSelect').value;
+            const bomCheck = document.getElementById('bomCheck');
+            const singleByte = encoding === 'iso-8859-1' || encoding === 'windows-1252';
+            bomCheck.disabled = singleByte;
+            if (singleByte) bomCheck.checked = false;
+        }
+
+        function changeFormat() {
+            if (!currentFormat) return;
+            updateBomState();
+            currentFormat = {
+                encoding: document.getElementById('encodingSelect').value,
+                bom: document.getElementById('bomCheck').checked,
+                eol: document.getElementById('eolSelect').value
+            };
+            dirty = true;
+            updateStatus(currentFile + ' (format modifié)');
+        }
+
+        // VÉRIFICATION AVANT SAUVEGARDE
+        async function showReviewModal() {
+            if (!currentFile || document.getElementById('editor').readOnly) return;
+            
+            try {
+                const res = await fetch('/api/save/review', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        path: currentFile,
+                        content: document.getElementById('editor').value,
+                        version: currentVersion,
+                        format: currentFormat
+                    })
+                });
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                const data = result.data;
+                const notes = ['+' + data.diff.added + ' −' + data.diff.removed];
+                if (data.deleted) {
+                    notes.push('le fichier n\'existe plus sur le serveur');
+                } else if (data.changed) {
+                    notes.push('le fichier a été modifié sur le serveur depuis son ouverture');
+                }
+                if (data.formatChanged) {
+                    notes.push('encodage ou fins de ligne modifiés (' + data.format.encoding + (data.format.bom ? ' BOM' : '') + ', ' + data.format.eol.toUpperCase() + (data.format.mixedEol ? ' mixtes' : '') + ' sur le serveur)');
+                }
+                
+                document.getElementById('reviewTitle').textContent = 'Modifications · ' + currentFile.split('/').pop();
+                document.getElementById('reviewSummary').textContent = notes.join(' · ');
+                renderDiff(document.getElementById('reviewDiff'), data.diff.unified);
+                document.getElementById('reviewModal').classList.remove('hidden');
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function hideReviewModal() {
+            document.getElementById('reviewModal').classList.add('hidden');
+        }
+
+        function saveFromReview() {
+            hideReviewModal();
+            saveFile();
+        }
+
+        // SURVEILLANCE DES CHANGEMENTS
+        function startWatching() {
+            if (changeEvents) changeEvents.close();
+            changeEvents = new EventSource('/api/watch');
+            changeEvents.addEventListener('change', onRemoteChange);
+            changeEvents.onopen = () => updateWatch();
+        }
+
+        function stopWatching() {
+            if (changeEvents) changeEvents.close();
+            changeEvents = null;
+        }
+
+        async function updateWatch() {
+            if (!changeEvents) return;
+            try {
+                await fetch('/api/watch/paths', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        file: currentFile,
+                        dirs: Array.from(expandedFolders)
+                    })
+                });
+            } catch (e) {
+                // La surveillance reprendra au prochain changement de sélection
+            }
+        }
+
+        function onRemoteChange(e) {
+            const event = JSON.parse(e.data);
+            
+            if (event.path === currentFile && Date.now() - lastSaveAt > 3000) {
+                if (event.type === 'delete') {
+                    showNotification(currentFile + ' a été supprimé sur le serveur', 'error');
+                } else if (event.type === 'modify' || event.type === 'create') {
+                    // Un remplacement atomique (vim, sed -i, rename) arrive en "create"
+                    clearTimeout(reloadTimer);
+                    reloadTimer = setTimeout(() => {
+                        if (dirty || viewer) {
+                            showNotification(currentFile.split('/').pop() + ' a été modifié sur le serveur', 'error');
+                        } else {
+                            loadFile(currentFile);
+                            showNotification(currentFile.split('/').pop() + ' rechargé (modifié sur le serveur)', 'success');
+                        }
+                    }, 500);
+                }
+            }
+            
+            if (event.type !== 'modify' || event.isDir) {
+                clearTimeout(treeRefreshTimer);
+                treeRefreshTimer = setTimeout(loadTree, 500);
+            }
+        }
+
+        // APERÇU MÉDIA
+        function previewKind(path) {
+            const ext = path.split('.').pop().toLowerCase();
+            const kinds = {
+                'jpg': 'image', 'jpeg': 'image', 'png': 'image', 'gif': 'image',
+                'webp': 'image', 'bmp': 'image', 'ico': 'image', 'svg': 'image',
+                'pdf': 'pdf',
+                'mp3': 'audio', 'ogg': 'audio', 'wav': 'audio', 'flac': 'audio', 'm4a': 'audio',
+                'mp4': 'video', 'webm': 'video', 'mov': 'video', 'mkv': 'video'
+            };
+            return kinds[ext] || null;
+        }
+
+        function showMediaPreview(path) {
+            const kind = previewKind(path);
+            const url = '/api/raw?path=' + encodeURIComponent(path);
+            const content = document.getElementById('media-content');
+            content.innerHTML = '';
+            
+            let el;
+            if (kind === 'image') {
+                el = document.createElement('img');
+                el.alt = path;
+            } else if (kind === 'pdf') {
+                el = document.createElement('iframe');
+            } else {
+                el = document.createElement(kind);
+                el.controls = true;
+            }
+            el.src = url;
+            el.onerror = () => showNotification('Aperçu impossible pour ' + path, 'error');
+            content.appendChild(el);
+            
+            currentFile = path;
+            closeViewer();
+            selectedFolder = path.substring(0, path.lastIndexOf('/')) || '/';
+            document.getElementById('editor').value = '';
+            document.getElementById('media-as-text').style.display = path.toLowerCase().endsWith('.svg') ? '' : 'none';
+            document.getElementById('media-preview').classList.remove('hidden');
+            updateWatch();
+            document.getElementById('current-file').textContent = path.split('/').pop() + ' (aperçu)';
+            document.getElementById('file-size').textContent = '';
+            document.getElementById('saveBtn').disabled = true;
+            document.getElementById('reviewBtn').disabled = true;
+            document.getElementById('historyBtn').disabled = true;
+            document.getElementById('language-info').textContent = kind.toUpperCase();
+            updateStatus(path);
+            
+            document.querySelectorAll('.tree-item').forEach(item => {
+                item.classList.toggle('selected', item.dataset.path === path);
+            });
+        }
+
+        function hideMediaPreview() {
+            document.getElementById('media-preview').classList.add('hidden');
+            document.getElementById('media-content').innerHTML = '';
+        }
+
+        // VISIONNEUSE PAR PAGES
+        function openViewer(path, size, mode) {
+            viewer = { path: path, size: size, line: 0, offset: 0, mode: mode || 'lines' };
+            document.getElementById('pager').classList.remove('hidden');
+            loadViewerPage();
+        }
+
+        function closeViewer() {
+            viewer = null;
+            document.getElementById('pager').classList.add('hidden');
+        }
+
+        async function loadViewerPage() {
+            if (!viewer) return;
+            
+            if (viewer.mode === 'hex') {
+                return loadHexPage();
+            }
+            
+            let url = '/api/file/range?path=' + encodeURIComponent(viewer.path);
+            if (viewer.mode === 'tail') {
+                url += '&offset=-' + VIEWER_TAIL_BYTES + '&length=' + VIEWER_TAIL_BYTES;
+            } else if (viewer.mode === 'bytes') {
+                url += '&offset=' + viewer.offset + '&length=' + VIEWER_TAIL_BYTES;
+            } else {
+                url += '&line=' + viewer.line + '&count=' + VIEWER_LINES;
+            }
+            
+            updateStatus('Chargement...', true);
+            try {
+                const res = await fetch(url);
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    updateStatus('Erreur');
+                    return;
+                }
+                
+                const page = result.data;
+                if (page.longLine) {
+                    // Ligne trop longue pour une page : lecture par octets
+                    showNotification('Ligne ' + (page.line + 1) + ' trop longue, affichage par octets');
+                    viewer.mode = 'bytes';
+                    viewer.offset = page.offset;
+                    return loadViewerPage();
+                }
+                document.getElementById('editor').value = page.content;
+                document.getElementById('editor').scrollTop = 0;
+                viewer.size = page.size;
+                viewer.eof = page.eof;
+                
+                let info;
+                if (viewer.mode === 'tail') {
+                    info = 'Fin du fichier (octets ' + page.offset + ' à ' + page.nextOffset + ')';
+                } else if (viewer.mode === 'bytes') {
+                    viewer.offset = page.offset;
+                    viewer.nextOffset = page.nextOffset;
+                    info = 'Octets ' + page.offset + ' à ' + page.nextOffset;
+                } else {
+                    viewer.line = page.line;
+                    viewer.nextLine = page.nextLine;
+                    info = 'Lignes ' + (page.line + 1) + ' à ' + page.nextLine;
+                }
+                document.getElementById('pager-info').textContent = info + ' · ' + formatBytes(page.size);
+                document.getElementById('pager-prev').disabled = viewer.mode === 'tail' || (viewer.mode === 'bytes' ? viewer.offset === 0 : viewer.line === 0);
+                document.getElementById('pager-next').disabled = viewer.mode === 'tail' || page.eof;
+                updateStatus(viewer.path);
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        async function loadHexPage() {
+            const url = '/api/file/hex?path=' + encodeURIComponent(viewer.path) + '&offset=' + viewer.offset + '&length=' + HEX_PAGE_BYTES;
+            
+            updateStatus('Chargement...', true);
+            try {
+                const res = await fetch(url);
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    updateStatus('Erreur');
+                    return;
+                }
+                
+                const page = result.data;
+                document.getElementById('editor').value = page.lines.join('\n');
+                document.getElementById('editor').scrollTop = 0;
+                viewer.size = page.size;
+                viewer.offset = page.offset;
+                viewer.eof = page.eof;
+                
+                document.getElementById('pager-info').textContent = 'Hex · octets ' + page.offset + ' à ' + page.nextOffset + ' · ' + formatBytes(page.size);
+                document.getElementById('pager-prev').disabled = page.offset === 0;
+                document.getElementById('pager-next').disabled = page.eof;
+                updateStatus(viewer.path);
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function viewerFirst() {
+            if (!viewer) return;
+            if (viewer.mode === 'hex') {
+                viewer.offset = 0;
+            } else {
+                viewer.mode = 'lines';
+                viewer.line = 0;
+            }
+            loadViewerPage();
+        }
+
+        function viewerPrev() {
+            if (!viewer) return;
+            if (viewer.mode === 'hex') {
+                viewer.offset = Math.max(0, viewer.offset - HEX_PAGE_BYTES);
+            } else if (viewer.mode === 'bytes') {
+                viewer.offset = Math.max(0, viewer.offset - VIEWER_TAIL_BYTES);
+            } else {
+                viewer.line = Math.max(0, viewer.line - VIEWER_LINES);
+            }
+            loadViewerPage();
+        }
+
+        function viewerNext() {
+            if (!viewer || viewer.eof) return;
+            if (viewer.mode === 'hex') {
+                viewer.offset += HEX_PAGE_BYTES;
+            } else if (viewer.mode === 'bytes') {
+                viewer.offset = viewer.nextOffset;
+            } else {
+                viewer.line = viewer.nextLine;
+            }
+            loadViewerPage();
+        }
+
+        function viewerLast() {
+            if (!viewer) return;
+            if (viewer.mode === 'hex') {
+                viewer.offset = Math.max(0, Math.floor((viewer.size - 1) / HEX_PAGE_BYTES) * HEX_PAGE_BYTES);
+            } else {
+                viewer.mode = 'tail';
+            }
+            loadViewerPage();
+        }
+
+        function viewerGoto() {
+            const input = document.getElementById('pager-goto').value.trim();
+            if (!viewer || !input) return;
+            if (viewer.mode === 'hex') {
+                const offset = input.toLowerCase().startsWith('0x') ? parseInt(input, 16) : parseInt(input);
+                if (isNaN(offset) || offset < 0) return;
+                viewer.offset = offset - offset % 16;
+            } else {
+                const line = parseInt(input);
+                if (!line || line < 1) return;
+                viewer.mode = 'lines';
+                viewer.line = line - 1;
+            }
+            loadViewerPage();
+        }
+
+        // CRÉATION
+        function showCreateModal(type, parent) {
+            createType = type;
+            document.getElementById('createTitle').textContent = type === 'file' ? 'Nouveau fichier' : 'Nouveau dossier';
+            document.getElementById('createParent').value = parent || selectedFolder;
+            document.getElementById('createName').value = '';
+            document.getElementById('createMode').value = '';
+            document.getElementById('createMode').placeholder = type === 'file' ? '0644' : '0755';
+            document.getElementById('createModal').classList.remove('hidden');
+        }
+
+        function hideCreateModal() {
+            document.getElementById('createModal').classList.add('hidden');
+        }
+
+        async function createItem() {
+            const name = document.getElementById('createName').value.trim();
+            if (!name) {
+                showNotification('Nom requis', 'error');
+                return;
+            }
+
+            try {
+                const res = await fetch('/api/create', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        type: createType,
+                        name: name,
+                        parent: document.getElementById('createParent').value.trim(),
+                        mode: document.getElementById('createMode').value.trim()
+                    })
+                });
+                const result = await res.json();
+                
+                if (result.success) {
+                    hideCreateModal();
+                    showNotification('Créé avec succès', 'success');
+                    expandAncestors(result.data.path);
+                    await loadTree();
+                    if (createType === 'file') loadFile(result.data.path);
+                } else {
+                    showNotification(result.message, 'error');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        // MENU CONTEXTUEL
+        function showContextMenu(e, path, isDir) {
+            const existing = document.querySelector('.context-menu');
+            if (existing) existing.remove();
+            
+            const menu = document.createElement('div');
+            menu.className = 'context-menu';
+            menu.style.left = e.pageX + 'px';
+            menu.style.top = e.pageY + 'px';
+            
+            if (isDir) {
+                const newFile = document.createElement('div');
+                newFile.className = 'context-menu-item';
+                newFile.innerHTML = '<span>+</span> Nouveau fichier ici';
+                newFile.onclick = function() { showCreateModal('file', path); };
+                menu.appendChild(newFile);
+                
+                const newFolder = document.createElement('div');
+                newFolder.className = 'context-menu-item';
+                newFolder.innerHTML = '<span>□</span> Nouveau dossier ici';
+                newFolder.onclick = function() { showCreateModal('folder', path); };
+                menu.appendChild(newFolder);
+                
+                const uploadHere = document.createElement('div');
+                uploadHere.className = 'context-menu-item';
+                uploadHere.innerHTML = '<span>⇪</span> Téléverser des fichiers ici';
+                uploadHere.onclick = function() { chooseUpload(path, false); };
+                menu.appendChild(uploadHere);
+                
+                const uploadFolder = document.createElement('div');
+                uploadFolder.className = 'context-menu-item';
+                uploadFolder.innerHTML = '<span>⇪</span> Téléverser un dossier ici';
+                uploadFolder.onclick = function() { chooseUpload(path, true); };
+                menu.appendChild(uploadFolder);
+                
+                const sync = document.createElement('div');
+                sync.className = 'context-menu-item';
+                sync.innerHTML = '<span>⇅</span> Synchroniser avec un dossier local…';
+                sync.onclick = function() { showSyncModal(path); };
+                menu.appendChild(sync);
+                
+                const terminal = document.createElement('div');
+                terminal.className = 'context-menu-item';
+                terminal.innerHTML = '<span>›_</span> Ouvrir un terminal ici';
+                terminal.onclick = function() { openTerminal(path); };
+                menu.appendChild(terminal);
+                
+                const sep = document.createElement('div');
+                sep.className = 'context-menu-divider';
+                menu.appendChild(sep);
+            }
+            
+            const duplicate = document.createElement('div');
+            duplicate.className = 'context-menu-item';
+            duplicate.innerHTML = '<span>⧉</span> Dupliquer';
+            duplicate.onclick = function() { copyItem(path, ''); };
+            menu.appendChild(duplicate);
+            
+            const copyTo = document.createElement('div');
+            copyTo.className = 'context-menu-item';
+            copyTo.innerHTML = '<span>→</span> Copier vers…';
+            copyTo.onclick = function() {
+                const destination = prompt('Copier ' + path + ' vers :', path);
+                if (destination && destination !== path) copyItem(path, destination);
+            };
+            menu.appendChild(copyTo);
+            
+            const compare = document.createElement('div');
+            compare.className = 'context-menu-item';
+            compare.innerHTML = '<span>⇄</span> Comparer avec…';
+            compare.onclick = function() { showCompareModal(path); };
+            menu.appendChild(compare);
+            
+            const perms = document.createElement('div');
+            perms.className = 'context-menu-item';
+            perms.innerHTML = '<span>⚿</span> Permissions…';
+            perms.onclick = function() { showPermModal(path); };
+            menu.appendChild(perms);
+            
+            const divider = document.createElement('div');
+            divider.className = 'context-menu-divider';
+            menu.appendChild(divider);
+            
+            const compressTgz = document.createElement('div');
+            compressTgz.className = 'context-menu-item';
+            compressTgz.innerHTML = '<span>▣</span> Compresser (.tar.gz)';
+            compressTgz.onclick = function() { createArchive(path, 'tar.gz'); };
+            menu.appendChild(compressTgz);
+            
+            const compressZip = document.createElement('div');
+            compressZip.className = 'context-menu-item';
+            compressZip.innerHTML = '<span>▣</span> Compresser (.zip)';
+            compressZip.onclick = function() { createArchive(path, 'zip'); };
+            menu.appendChild(compressZip);
+            
+            if (!isDir && archiveBaseName(path.split('/').pop())) {
+                const extractHere = document.createElement('div');
+                extractHere.className = 'context-menu-item';
+                extractHere.innerHTML = '<span>▤</span> Extraire ici';
+                extractHere.onclick = function() { extractArchive(path, true); };
+                menu.appendChild(extractHere);
+                
+                const extractFolder = document.createElement('div');
+                extractFolder.className = 'context-menu-item';
+                extractFolder.innerHTML = '<span>▤</span>';
+                extractFolder.appendChild(document.createTextNode(' Extraire dans ' + archiveBaseName(path.split('/').pop()) + '/'));
+                extractFolder.onclick = function() { extractArchive(path, false); };
+                menu.appendChild(extractFolder);
+            }
+            
+            const archiveDivider = document.createElement('div');
+            archiveDivider.className = 'context-menu-divider';
+            menu.appendChild(archiveDivider);
+            
+            if (isDir) {
+                const zip = document.createElement('div');
+                zip.className = 'context-menu-item';
+                zip.innerHTML = '<span>⇩</span> Télécharger (.zip)';
+                zip.onclick = function() { downloadItem(path, 'zip'); };
+                menu.appendChild(zip);
+                
+                const tgz = document.createElement('div');
+                tgz.className = 'context-menu-item';
+                tgz.innerHTML = '<span>⇩</span> Télécharger (.tar.gz)';
+                tgz.onclick = function() { downloadItem(path, 'tar.gz'); };
+                menu.appendChild(tgz);
+            } else {
+                const download = document.createElement('div');
+                download.className = 'context-menu-item';
+                download.innerHTML = '<span>⇩</span> Télécharger';
+                download.onclick = function() { downloadItem(path, ''); };
+                menu.appendChild(download);
+            }
+            
+            const item = document.createElement('div');
+            item.className = 'context-menu-item danger';
+            item.innerHTML = '<span>×</span> Supprimer';
+            item.onclick = function() { deleteItem(path, false); };
+            menu.appendChild(item);
+            
+            const permanent = document.createElement('div');
+            permanent.className = 'context-menu-item danger';
+            permanent.innerHTML = '<span>⊗</span> Supprimer définitivement';
+            permanent.onclick = function() { deleteItem(path, true); };
+            menu.appendChild(permanent);
+            
+            document.body.appendChild(menu);
+            contextMenuTarget = path;
+            
+            setTimeout(() => {
+                document.addEventListener('click', closeContextMenu);
+            }, 10);
+        }
+
+        function closeContextMenu() {
+            const menu = document.querySelector('.context-menu');
+            if (menu) menu.remove();
+            document.removeEventListener('click', closeContextMenu);
+        }
+
+        async function copyItem(source, destination) {
+            updateStatus('Copie...', true);
+            
+            try {
+                const res = await fetch('/api/copy', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({ source: source, destination: destination })
+                });
+                const result = await res.json();
+                
+                if (result.success) {
+                    showNotification('Copié vers ' + result.data.path, 'success');
+                    loadTree();
+                } else {
+                    showNotification(result.message, 'error');
+                    updateStatus('Erreur');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        async function deleteItem(path, permanent) {
+            try {
+                const previewRes = await fetch('/api/delete/preview?path=' + encodeURIComponent(path));
+                const preview = await previewRes.json();
+                if (!preview.success) {
+                    showNotification(preview.message, 'error');
+                    return;
+                }
+                
+                const scope = preview.data;
+                let message = permanent ? 'Supprimer définitivement ' + path + ' ?' : 'Mettre ' + path + ' à la corbeille ?';
+                if (scope.dirs > 0) {
+                    message += '\n\n' + scope.files + ' fichier(s) et ' + scope.dirs + ' dossier(s), ' + formatBytes(scope.size) + ' au total :\n';
+                    message += scope.entries.slice(0, 15).map(e => '  ' + e.path).join('\n');
+                    if (scope.entries.length > 15 || scope.truncated) message += '\n  …';
+                }
+                if (!confirm(message)) return;
+                
+                const res = await fetch('/api/delete', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({ path: path, permanent: permanent })
+                });
+                const result = await res.json();
+                
+                if (result.success) {
+                    showNotification(result.message, 'success');
+                    if (currentFile === path || currentFile.startsWith(path + '/')) {
+                        currentFile = '';
+                        hideMediaPreview();
+                        document.getElementById('editor').value = '';
+                        document.getElementById('saveBtn').disabled = true;
+                        document.getElementById('reviewBtn').disabled = true;
+                    }
+                    loadTree();
+                } else {
+                    showNotification(result.message, 'error');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        // TÉLÉVERSEMENT
+        function chooseUpload(parent, folder) {
+            uploadTarget = parent || selectedFolder;
+            const input = document.getElementById(folder ? 'uploadFolderInput' : 'uploadInput');
+            input.value = '';
+            input.click();
+        }
+
+        function onUploadInput(e) {
+            const items = Array.from(e.target.files).map(file => ({
+                file: file,
+                path: file.webkitRelativePath || file.name
+            }));
+            uploadFiles(uploadTarget, items, false);
+        }
+
+        async function dropUpload(e, parent) {
+            const entries = Array.from(e.dataTransfer.items || [])
+                .map(item => item.webkitGetAsEntry ? item.webkitGetAsEntry() : null)
+                .filter(Boolean);
+            const files = Array.from(e.dataTransfer.files);
+            
+            const items = [];
+            if (entries.length === 0) {
+                files.forEach(file => items.push({ file: file, path: file.name }));
+            } else {
+                for (const entry of entries) {
+                    await collectEntry(entry, '', items);
+                }
+            }
+            uploadFiles(parent, items, false);
+        }
+
+        function collectEntry(entry, prefix, items) {
+            return new Promise((resolve, reject) => {
+                if (entry.isFile) {
+                    entry.file(file => {
+                        items.push({ file: file, path: prefix + file.name });
+                        resolve();
+                    }, reject);
+                    return;
+                }
+                
+                const reader = entry.createReader();
+                const readBatch = () => reader.readEntries(async children => {
+                    if (children.length === 0) {
+                        resolve();
+                        return;
+                    }
+                    for (const child of children) {
+                        await collectEntry(child, prefix + entry.name + '/', items);
+                    }
+                    readBatch();
+                }, reject);
+                readBatch();
+            });
+        }
+
+        async function uploadFiles(parent, items, overwrite) {
+            if (items.length === 0) return;
+            
+            const form = new FormData();
+            form.append('parent', parent);
+            form.append('overwrite', overwrite ? 'true' : 'false');
+            items.forEach(item => {
+                form.append('path', item.path);
+                form.append('file', item.file, item.file.name);
+            });
+            
+            updateStatus('Téléversement de ' + items.length + ' fichier(s)...', true);
+            
+            try {
+                const res = await fetch('/api/upload', { method: 'POST', body: form });
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    updateStatus('Erreur');
+                    return;
+                }
+                
+                showNotification(result.message, 'success');
+                updateStatus('Prêt');
+                if (parent) expandedFolders.add(parent);
+                loadTree();
+                
+                const skipped = result.data.skipped;
+                if (skipped.length > 0 && confirm(skipped.length + ' fichier(s) existent déjà :\n' + skipped.slice(0, 15).join('\n') + '\n\nLes écraser ?')) {
+                    uploadFiles(parent, items.filter(item => skipped.includes(item.path)), true);
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+                updateStatus('Erreur');
+            }
+        }
+
+        function downloadItem(path, format) {
+            let url = '/api/download?path=' + encodeURIComponent(path);
+            if (format) url += '&format=' + encodeURIComponent(format);
+            
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = '';
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+        }
+
+        // HISTORIQUE
+        async function showHistoryModal() {
+            if (!currentFile) return;
+            document.getElementById('historyTitle').textContent = 'Historique · ' + currentFile.split('/').pop();
+            document.getElementById('historyDiff').classList.add('hidden');
+            document.getElementById('historyModal').classList.remove('hidden');
+            loadHistory();
+        }
+
+        function hideHistoryModal() {
+            document.getElementById('historyModal').classList.add('hidden');
+        }
+
+        async function loadHistory() {
+            const list = document.getElementById('historyList');
+            list.innerHTML = '';
+            
+            try {
+                const res = await fetch('/api/history?path=' + encodeURIComponent(currentFile));
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                if (result.data.length === 0) {
+                    list.innerHTML = '<div class="empty">Aucune version enregistrée pour ce fichier</div>';
+                    return;
+                }
+                
+                result.data.forEach((version, i) => {
+                    const row = document.createElement('div');
+                    row.className = 'list-row';
+                    
+                    const name = document.createElement('span');
+                    name.className = 'name';
+                    name.textContent = new Date(version.time).toLocaleString() + (version.note ? ' · ' + version.note : '');
+                    row.appendChild(name);
+                    
+                    const meta = document.createElement('span');
+                    meta.className = 'meta';
+                    meta.textContent = version.user + ' · ' + formatBytes(version.size);
+                    row.appendChild(meta);
+                    
+                    if (i + 1 < result.data.length) {
+                        const prev = document.createElement('button');
+                        prev.textContent = 'Δ précédente';
+                        prev.onclick = () => showHistoryDiff(result.data[i + 1].id, version.id);
+                        row.appendChild(prev);
+                    }
+                    
+                    const current = document.createElement('button');
+                    current.textContent = 'Δ serveur';
+                    current.onclick = () => showHistoryDiff(version.id, 'current');
+                    row.appendChild(current);
+                    
+                    const restore = document.createElement('button');
+                    restore.className = 'primary';
+                    restore.textContent = 'Restaurer';
+                    restore.onclick = () => restoreVersion(version.id);
+                    row.appendChild(restore);
+                    
+                    list.appendChild(row);
+                });
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        async function showHistoryDiff(from, to) {
+            try {
+                const url = '/api/history/diff?path=' + encodeURIComponent(currentFile) + '&from=' + encodeURIComponent(from) + '&to=' + encodeURIComponent(to);
+                const res = await fetch(url);
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                const view = document.getElementById('historyDiff');
+                renderDiff(view, result.data.unified);
+                view.classList.remove('hidden');
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        async function restoreVersion(id) {
+            if (dirty && !confirm('Vos modifications non sauvegardées seront perdues. Continuer ?')) return;
+            if (!confirm('Restaurer cette version sur le serveur ?')) return;
+            
+            try {
+                const res = await fetch('/api/history/restore', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({ path: currentFile, id: id })
+                });
+                const result = await res.json();
+                
+                if (result.success) {
+                    document.getElementById('editor').value = result.data.content;
+                    baseContent = result.data.content;
+                    currentVersion = result.data.version;
+                    showFormat(result.data.format);
+                    dirty = false;
+                    lastSaveAt = Date.now();
+                    showNotification(result.message, 'success');
+                    loadHistory();
+                } else {
+                    showNotification(result.message, 'error');
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function renderDiff(container, unified) {
+            container.innerHTML = '';
+            if (!unified) {
+                container.innerHTML = '<div class="empty">Aucune différence</div>';
+                return;
+            }
+            
+            unified.replace(/\n$/, '').split('\n').forEach(line => {
+                const div = document.createElement('div');
+                if (line.startsWith('@@')) {
+                    div.className = 'hunk';
+                } else if (line.startsWith('+') && !line.startsWith('+++')) {
+                    div.className = 'add';
+                } else if (line.startsWith('-') && !line.startsWith('---')) {
+                    div.className = 'del';
+                }
+                div.textContent = line || ' ';
+                container.appendChild(div);
+            });
+        }
+
+        // COMPARAISON
+        function showCompareModal(path) {
+            document.getElementById('compareLeft').value = path;
+            document.getElementById('compareRight').value = path;
+            document.getElementById('compareSummary').textContent = '';
+            document.getElementById('compareResult').innerHTML = '';
+            document.getElementById('compareBackBtn').classList.add('hidden');
+            compareParent = null;
+            document.getElementById('compareModal').classList.remove('hidden');
+            document.getElementById('compareRight').focus();
+        }
+
+        function hideCompareModal() {
+            document.getElementById('compareModal').classList.add('hidden');
+            document.getElementById('comparePassword').value = '';
+        }
+
+        function compareRequest(left, right) {
+            const request = {
+                left: { path: left },
+                right: { path: right },
+                format: document.getElementById('compareFormat').value
+            };
+            if (document.getElementById('compareRemote').checked) {
+                request.right.connection = {
+                    host: document.getElementById('compareHost').value,
+                    port: document.getElementById('comparePort').value,
+                    username: document.getElementById('compareUser').value,
+                    password: document.getElementById('comparePassword').value
+                };
+            }
+            return request;
+        }
+
+        async function runCompare(left, right) {
+            if (!left) compareParent = null;
+            left = left || document.getElementById('compareLeft').value;
+            right = right || document.getElementById('compareRight').value;
+            if (!left || !right) return;
+            
+            const summary = document.getElementById('compareSummary');
+            const container = document.getElementById('compareResult');
+            summary.textContent = 'Comparaison...';
+            container.innerHTML = '';
+            
+            try {
+                const res = await fetch('/api/compare', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify(compareRequest(left, right))
+                });
+                const result = await res.json();
+                
+                if (!result.success) {
+                    summary.textContent = '';
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                if (result.data.type === 'dir') {
+                    compareParent = { left: left, right: right };
+                    document.getElementById('compareBackBtn').classList.add('hidden');
+                    renderDirComparison(result.data);
+                } else {
+                    document.getElementById('compareBackBtn').classList.toggle('hidden', !compareParent);
+                    renderFileComparison(result.data);
+                }
+            } catch (e) {
+                summary.textContent = '';
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function compareBack() {
+            if (compareParent) runCompare(compareParent.left, compareParent.right);
+        }
+
+        function renderFileComparison(data) {
+            const summary = document.getElementById('compareSummary');
+            const container = document.getElementById('compareResult');
+            summary.textContent = data.left + '  ⇄  ' + data.right;
+            
+            if (data.identical) {
+                summary.textContent += ' · fichiers identiques';
+                return;
+            }
+            if (data.reason === 'binary' || data.reason === 'large') {
+                summary.textContent += ' · contenus différents (' + (data.reason === 'binary' ? 'fichier binaire' : 'fichier volumineux') + ', ' + formatBytes(data.leftSize) + ' / ' + formatBytes(data.rightSize) + ')';
+                return;
+            }
+            summary.textContent += ' · +' + data.diff.added + ' −' + data.diff.removed;
+            
+            if (!data.rows) {
+                const view = document.createElement('div');
+                view.className = 'diff-view';
+                renderDiff(view, data.diff.unified);
+                container.appendChild(view);
+                return;
+            }
+            
+            const grid = document.createElement('div');
+            grid.className = 'side-diff';
+            const cell = (text, className) => {
+                const span = document.createElement('span');
+                span.className = className;
+                span.textContent = text;
+                grid.appendChild(span);
+            };
+            data.rows.forEach(row => {
+                if (row.kind === 'skip') {
+                    cell('⋯ ' + row.count + ' ligne(s) identique(s)', 'skip');
+                    return;
+                }
+                const leftClass = row.kind === 'same' ? '' : 'del';
+                const rightClass = row.kind === 'same' ? '' : 'add';
+                cell(row.left ? String(row.left.num) : '', 'num ' + leftClass);
+                cell(row.left ? row.left.text : '', leftClass);
+                cell(row.right ? String(row.right.num) : '', 'num ' + rightClass);
+                cell(row.right ? row.right.text : '', rightClass);
+            });
+            container.appendChild(grid);
+        }
+
+        function renderDirComparison(data) {
+            const summary = document.getElementById('compareSummary');
+            const container = document.getElementById('compareResult');
+            summary.textContent = data.left + '  ⇄  ' + data.right + (data.truncated ? ' · liste tronquée' : '');
+            
+            const list = document.createElement('div');
+            list.className = 'item-list';
+            const reasons = { size: 'taille', content: 'contenu', type: 'type', link: 'lien' };
+            const sections = [
+                ['Différents', data.differing],
+                ['Seulement à gauche', data.onlyLeft],
+                ['Seulement à droite', data.onlyRight],
+                ['Identiques', data.identical]
+            ];
+            
+            sections.forEach(([title, entries]) => {
+                const header = document.createElement('div');
+                header.className = 'list-section';
+                header.textContent = title + ' (' + entries.length + ')';
+                list.appendChild(header);
+                
+                entries.forEach(entry => {
+                    const row = document.createElement('div');
+                    row.className = 'list-row';
+                    
+                    const name = document.createElement('span');
+                    name.className = 'name';
+                    name.textContent = (entry.isDir ? '📁 ' : '') + entry.path;
+                    row.appendChild(name);
+                    
+                    const meta = document.createElement('span');
+                    meta.className = 'meta';
+                    if (entry.reason) {
+                        meta.textContent = (reasons[entry.reason] || entry.reason) + ' · ' + formatBytes(entry.leftSize) + ' / ' + formatBytes(entry.rightSize);
+                    } else if (!entry.isDir) {
+                        meta.textContent = formatBytes(entry.leftSize || entry.rightSize);
+                    }
+                    row.appendChild(meta);
+                    
+                    if (title === 'Différents' && !entry.isDir && entry.reason !== 'type') {
+                        const show = document.createElement('button');
+                        show.textContent = 'Δ';
+                        show.title = 'Comparer les fichiers';
+                        const parent = compareParent;
+                        show.onclick = () => runCompare(parent.left + '/' + entry.path, parent.right + '/' + entry.path);
+                        row.appendChild(show);
+                    }
+                    
+                    list.appendChild(row);
+                });
+            });
+            container.appendChild(list);
+        }
+
+        // TERMINAL
+        // Émulateur minimal (séquences ANSI/VT100 courantes, couleurs 256 et
+        // RVB, écran alternatif) relié à un shell distant par WebSocket.
+        const terminalScrollback = 2000;
+        const terminalPalette = buildTerminalPalette();
+        const terminalDefaultStyle = {};
+        let terminals = [];
+        let activeTerminal = null;
+        let terminalCounter = 0;
+
+        function buildTerminalPalette() {
+            const palette = [
+                '#000000', '#cd3131', '#0dbc79', '#e5e510', '#2472c8', '#bc3fbc', '#11a8cd', '#e5e5e5',
+                '#666666', '#f14c4c', '#23d18b', '#f5f543', '#3b8eea', '#d670d6', '#29b8db', '#ffffff'
+            ];
+            const levels = [0, 95, 135, 175, 215, 255];
+            for (let r = 0; r < 6; r++) {
+                for (let g = 0; g < 6; g++) {
+                    for (let b = 0; b < 6; b++) {
+                        palette.push('rgb(' + levels[r] + ',' + levels[g] + ',' + levels[b] + ')');
+                    }
+                }
+            }
+            for (let i = 0; i < 24; i++) {
+                const v = 8 + i * 10;
+                palette.push('rgb(' + v + ',' + v + ',' + v + ')');
+            }
+            return palette;
+        }
+
+        function toggleTerminalPanel() {
+            const panel = document.getElementById('terminal-panel');
+            if (!panel.classList.contains('hidden')) {
+                panel.classList.add('hidden');
+                document.getElementById('editor').focus();
+                return;
+            }
+            if (terminals.length === 0) {
+                openTerminal(selectedFolder);
+                return;
+            }
+            panel.classList.remove('hidden');
+            activateTerminal(activeTerminal || terminals[0]);
+        }
+
+        function openTerminal(dir) {
+            if (!document.getElementById('connection-info').textContent) {
+                showNotification('Non connecté', 'error');
+                return;
+            }
+            document.getElementById('terminal-panel').classList.remove('hidden');
+
+            terminalCounter++;
+            const term = {
+                title: 'Terminal ' + terminalCounter,
+                cols: 80,
+                rows: 24,
+                grid: [],
+                saved: null,
+                alt: null,
+                x: 0,
+                y: 0,
+                wrapPending: false,
+                top: 0,
+                bottom: 23,
+                style: terminalDefaultStyle,
+                blank: terminalDefaultStyle,
+                appCursor: false,
+                cursorVisible: true,
+                bracketedPaste: false,
+                state: 'normal',
+                params: '',
+                osc: '',
+                dirty: new Set(),
+                renderPending: false,
+                decoder: new TextDecoder(),
+                exited: false
+            };
+
+            term.el = document.createElement('div');
+            term.el.className = 'terminal-screen';
+            term.el.tabIndex = 0;
+            term.historyEl = document.createElement('div');
+            term.screenEl = document.createElement('div');
+            term.el.appendChild(term.historyEl);
+            term.el.appendChild(term.screenEl);
+            term.el.addEventListener('keydown', (e) => terminalKey(term, e));
+            term.el.addEventListener('paste', (e) => {
+                e.preventDefault();
+                const text = (e.clipboardData || window.clipboardData).getData('text').replace(/\r?\n/g, '\r');
+                terminalSend(term, term.bracketedPaste ? '\x1b[200~' + text + '\x1b[201~' : text);
+            });
+            document.getElementById('terminal-body').appendChild(term.el);
+
+            term.tab = document.createElement('div');
+            term.tab.className = 'terminal-tab';
+            term.tab.title = dir || '';
+            term.label = document.createElement('span');
+            term.label.textContent = term.title;
+            term.tab.appendChild(term.label);
+            const close = document.createElement('span');
+            close.className = 'close';
+            close.textContent = '×';
+            close.onclick = (e) => {
+                e.stopPropagation();
+                closeTerminal(term);
+            };
+            term.tab.appendChild(close);
+            term.tab.onclick = () => activateTerminal(term);
+            document.getElementById('terminal-tabs').appendChild(term.tab);
+
+            terminals.push(term);
+            activateTerminal(term);
+            if (term.grid.length === 0) terminalResize(term, term.cols, term.rows);
+
+            const params = new URLSearchParams({ path: dir || '', cols: term.cols, rows: term.rows });
+            const scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+            term.ws = new WebSocket(scheme + location.host + '/api/terminal?' + params.toString());
+            term.ws.binaryType = 'arraybuffer';
+            term.ws.onmessage = (e) => {
+                if (typeof e.data !== 'string') {
+                    terminalWrite(term, term.decoder.decode(new Uint8Array(e.data), { stream: true }));
+                    return;
+                }
+                const msg = JSON.parse(e.data);
+                if (msg.type === 'exit') {
+                    terminalExited(term, msg.error || 'processus terminé (code ' + msg.code + ')');
+                }
+            };
+            term.ws.onclose = () => terminalExited(term, 'connexion fermée');
+        }
+
+        function terminalExited(term, reason) {
+            if (term.exited) return;
+            term.exited = true;
+            term.tab.classList.add('exited');
+            terminalWrite(term, '\r\n\x1b[0m\x1b[2m[' + reason + ']\x1b[0m\r\n');
+        }
+
+        function activateTerminal(term) {
+            activeTerminal = term;
+            terminals.forEach(t => {
+                t.el.classList.toggle('hidden', t !== term);
+                t.tab.classList.toggle('active', t === term);
+            });
+            terminalFit(term, true);
+            term.el.focus();
+        }
+
+        function closeTerminal(term) {
+            if (term.ws) term.ws.close();
+            term.el.remove();
+            term.tab.remove();
+            terminals = terminals.filter(t => t !== term);
+            if (activeTerminal === term) activeTerminal = null;
+            if (terminals.length > 0) {
+                activateTerminal(terminals[terminals.length - 1]);
+            } else {
+                document.getElementById('terminal-panel').classList.add('hidden');
+            }
+        }
+
+        function closeAllTerminals() {
+            terminals.slice().forEach(closeTerminal);
+            terminalCounter = 0;
+        }
+
+        function terminalSend(term, data) {
+            if (term.ws && term.ws.readyState === WebSocket.OPEN) {
+                term.ws.send(JSON.stringify({ type: 'input', data: data }));
+            }
+        }
+
+        function terminalKey(term, e) {
+            if (e.ctrlKey && !e.shiftKey && (e.key === 'j' || e.key === 'J')) return;
+            // Copier la sélection et coller restent gérés par le navigateur
+            if ((e.ctrlKey || e.metaKey) && (e.key === 'c' || e.key === 'C') && window.getSelection().toString()) return;
+            if ((e.ctrlKey || e.metaKey) && (e.key === 'v' || e.key === 'V')) return;
+            if (e.metaKey) return;
+
+            const csi = term.appCursor ? '\x1bO' : '\x1b[';
+            const keys = {
+                Enter: '\r', Backspace: '\x7f', Tab: '\t', Escape: '\x1b',
+                ArrowUp: csi + 'A', ArrowDown: csi + 'B', ArrowRight: csi + 'C', ArrowLeft: csi + 'D',
+                Home: csi + 'H', End: csi + 'F',
+                Insert: '\x1b[2~', Delete: '\x1b[3~', PageUp: '\x1b[5~', PageDown: '\x1b[6~',
+                F1: '\x1bOP', F2: '\x1bOQ', F3: '\x1bOR', F4: '\x1bOS',
+                F5: '\x1b[15~', F6: '\x1b[17~', F7: '\x1b[18~', F8: '\x1b[19~',
+                F9: '\x1b[20~', F10: '\x1b[21~', F11: '\x1b[23~', F12: '\x1b[24~'
+            };
+
+            let data = null;
+            if (e.key === 'Tab' && e.shiftKey) {
+                data = '\x1b[Z';
+            } else if (keys[e.key] !== undefined) {
+                data = keys[e.key];
+            } else if (e.ctrlKey && !e.altKey && e.key.length === 1) {
+                const code = e.key.toUpperCase().charCodeAt(0);
+                if (code >= 64 && code <= 95) {
+                    data = String.fromCharCode(code - 64);
+                } else if (e.key === ' ') {
+                    data = '\x00';
+                }
+            } else if (e.key.length === 1) {
+                data = e.key;
+            }
+            if (data === null) return;
+
+            if (e.altKey && !e.ctrlKey) data = '\x1b' + data;
+            e.preventDefault();
+            e.stopPropagation();
+            terminalSend(term, data);
+            term.el.scrollTop = term.el.scrollHeight;
+        }
+
+        // Calcule le nombre de lignes et de colonnes visibles
+        function terminalFit(term, notify) {
+            if (term.el.clientWidth === 0) return;
+            const probe = document.createElement('span');
+            probe.textContent = 'MMMMMMMMMM';
+            term.screenEl.appendChild(probe);
+            const box = probe.getBoundingClientRect();
+            probe.remove();
+
+            const style = getComputedStyle(term.el);
+            const width = term.el.clientWidth - parseFloat(style.paddingLeft) - parseFloat(style.paddingRight);
+            const height = term.el.clientHeight - parseFloat(style.paddingTop) - parseFloat(style.paddingBottom);
+            const lineHeight = parseFloat(style.lineHeight) || box.height;
+            const cols = Math.max(10, Math.floor(width / (box.width / 10)));
+            const rows = Math.max(3, Math.floor(height / lineHeight));
+
+            if (term.grid.length > 0 && cols === term.cols && rows === term.rows) return;
+            terminalResize(term, cols, rows);
+            if (notify && term.ws && term.ws.readyState === WebSocket.OPEN) {
+                term.ws.send(JSON.stringify({ type: 'resize', cols: cols, rows: rows }));
+            }
+        }
+
+        function terminalBlankRow(term) {
+            const row = [];
+            for (let i = 0; i < term.cols; i++) row.push({ c: ' ', s: term.blank });
+            return row;
+        }
+
+        function terminalResize(term, cols, rows) {
+            const resizeGrid = (grid, keepHistory) => {
+                grid.forEach(row => {
+                    while (row.length < cols) row.push({ c: ' ', s: terminalDefaultStyle });
+                    row.length = cols;
+                });
+                while (grid.length > rows) {
+                    const row = grid.shift();
+                    if (keepHistory) terminalPushHistory(term, row);
+                }
+                while (grid.length < rows) {
+                    const row = [];
+                    for (let i = 0; i < cols; i++) row.push({ c: ' ', s: terminalDefaultStyle });
+                    grid.push(row);
+                }
+            };
+
+            const shift = Math.max(0, term.y - rows + 1);
+            term.cols = cols;
+            term.rows = rows;
+            resizeGrid(term.grid, !term.alt);
+            if (term.alt) resizeGrid(term.alt.grid, true);
+            term.y = Math.max(0, term.y - shift);
+            term.x = Math.min(term.x, cols - 1);
+            term.top = 0;
+            term.bottom = rows - 1;
+            term.wrapPending = false;
+
+            term.screenEl.innerHTML = '';
+            for (let i = 0; i < rows; i++) {
+                term.screenEl.appendChild(document.createElement('div'));
+                term.dirty.add(i);
+            }
+            terminalScheduleRender(term);
+        }
+
+        function terminalPushHistory(term, row) {
+            const line = document.createElement('div');
+            line.innerHTML = terminalRowHtml(term, row, -1);
+            term.historyEl.appendChild(line);
+            if (term.historyEl.childNodes.length > terminalScrollback) {
+                term.historyEl.firstChild.remove();
+            }
+        }
+
+        // Les lignes qui sortent par le haut de l'écran principal vont dans
+        // l'historique quand toHistory est vrai (défilement par saut de ligne)
+        function terminalScrollUp(term, n, toHistory) {
+            for (let i = 0; i < n; i++) {
+                const row = term.grid.splice(term.top, 1)[0];
+                if (toHistory && !term.alt && term.top === 0) terminalPushHistory(term, row);
+                term.grid.splice(term.bottom, 0, terminalBlankRow(term));
+            }
+            for (let i = term.top; i <= term.bottom; i++) term.dirty.add(i);
+        }
+
+        function terminalScrollDown(term, n) {
+            for (let i = 0; i < n; i++) {
+                term.grid.splice(term.bottom, 1);
+                term.grid.splice(term.top, 0, terminalBlankRow(term));
+            }
+            for (let i = term.top; i <= term.bottom; i++) term.dirty.add(i);
+        }
+
+        function terminalLineFeed(term) {
+            if (term.y === term.bottom) {
+                terminalScrollUp(term, 1, true);
+            } else if (term.y < term.rows - 1) {
+                term.y++;
+            }
+        }
+
+        function terminalErase(term, y, from, to) {
+            const row = term.grid[y];
+            for (let x = Math.max(0, from); x < Math.min(to, term.cols); x++) {
+                row[x] = { c: ' ', s: term.blank };
+            }
+            term.dirty.add(y);
+        }
+
+        function terminalPrint(term, ch) {
+            if (term.wrapPending) {
+                term.x = 0;
+                terminalLineFeed(term);
+                term.wrapPending = false;
+            }
+            term.grid[term.y][term.x] = { c: ch, s: term.style };
+            term.dirty.add(term.y);
+            if (term.x === term.cols - 1) {
+                term.wrapPending = true;
+            } else {
+                term.x++;
+            }
+        }
+
+        function terminalWrite(term, text) {
+            for (const ch of text) {
+                const code = ch.codePointAt(0);
+                switch (term.state) {
+                    case 'normal':
+                        if (code >= 32 && code !== 127) {
+                            terminalPrint(term, ch);
+                        } else {
+                            terminalControl(term, ch);
+                        }
+                        break;
+                    case 'esc':
+                        terminalEscape(term, ch);
+                        break;
+                    case 'charset':
+                        term.state = 'normal';
+                        break;
+                    case 'csi':
+                        if (code >= 0x40 && code <= 0x7e) {
+                            term.state = 'normal';
+                            terminalCsi(term, ch, term.params);
+                        } else {
+                            term.params += ch;
+                        }
+                        break;
+                    case 'osc':
+                        if (ch === '\x07') {
+                            terminalOsc(term);
+                        } else if (ch === '\x1b') {
+                            term.state = 'oscEsc';
+                        } else {
+                            term.osc += ch;
+                        }
+                        break;
+                    case 'oscEsc':
+                        terminalOsc(term);
+                        break;
+                }
+            }
+            terminalScheduleRender(term);
+        }
+
+        function terminalControl(term, ch) {
+            switch (ch) {
+                case '\r':
+                    term.x = 0;
+                    term.wrapPending = false;
+                    break;
+                case '\n':
+                case '\x0b':
+                case '\x0c':
+                    terminalLineFeed(term);
+                    term.wrapPending = false;
+                    break;
+                case '\b':
+                    if (term.x > 0) term.x--;
+                    term.wrapPending = false;
+                    break;
+                case '\t':
+                    term.x = Math.min(term.cols - 1, (Math.floor(term.x / 8) + 1) * 8);
+                    break;
+                case '\x1b':
+                    term.state = 'esc';
+                    break;
+            }
+        }
+
+        function terminalEscape(term, ch) {
+            term.state = 'normal';
+            switch (ch) {
+                case '[':
+                    term.state = 'csi';
+                    term.params = '';
+                    break;
+                case ']':
+                    term.state = 'osc';
+                    term.osc = '';
+                    break;
+                case '(':
+                case ')':
+                case '*':
+                case '+':
+                    term.state = 'charset';
+                    break;
+                case '7':
+                    term.saved = { x: term.x, y: term.y, style: term.style };
+                    break;
+                case '8':
+                    terminalRestoreCursor(term);
+                    break;
+                case 'D':
+                    terminalLineFeed(term);
+                    break;
+                case 'E':
+                    term.x = 0;
+                    terminalLineFeed(term);
+                    break;
+                case 'M':
+                    if (term.y === term.top) {
+                        terminalScrollDown(term, 1);
+                    } else if (term.y > 0) {
+                        term.y--;
+                    }
+                    break;
+                case 'c':
+                    term.style = terminalDefaultStyle;
+                    term.blank = terminalDefaultStyle;
+                    term.top = 0;
+                    term.bottom = term.rows - 1;
+                    term.x = 0;
+                    term.y = 0;
+                    for (let y = 0; y < term.rows; y++) terminalErase(term, y, 0, term.cols);
+                    break;
+            }
+        }
+
+        function terminalOsc(term) {
+            term.state = 'normal';
+            const sep = term.osc.indexOf(';');
+            const kind = term.osc.substring(0, sep);
+            if (sep > 0 && (kind === '0' || kind === '2')) {
+                term.label.textContent = term.osc.substring(sep + 1) || term.title;
+            }
+        }
+
+        function terminalRestoreCursor(term) {
+            if (!term.saved) return;
+            term.x = Math.min(term.saved.x, term.cols - 1);
+            term.y = Math.min(term.saved.y, term.rows - 1);
+            term.style = term.saved.style;
+            term.wrapPending = false;
+        }
+
+        function terminalSetAltScreen(term, on) {
+            if (on && !term.alt) {
+                term.alt = { grid: term.grid };
+                term.grid = [];
+                for (let y = 0; y < term.rows; y++) {
+                    const row = [];
+                    for (let x = 0; x < term.cols; x++) row.push({ c: ' ', s: terminalDefaultStyle });
+                    term.grid.push(row);
+                }
+            } else if (!on && term.alt) {
+                term.grid = term.alt.grid;
+                term.alt = null;
+            } else {
+                return;
+            }
+            term.top = 0;
+            term.bottom = term.rows - 1;
+            for (let y = 0; y < term.rows; y++) term.dirty.add(y);
+        }
+
+        function terminalCsi(term, final, raw) {
+            const prefix = /^[?>=<]/.test(raw) ? raw[0] : '';
+            const args = raw.substring(prefix.length).replace(/[ -\/]+$/, '').split(';').map(v => parseInt(v, 10) || 0);
+            const arg = (i, def) => args[i] || def;
+            const clampCursor = () => {
+                term.x = Math.max(0, Math.min(term.cols - 1, term.x));
+                term.y = Math.max(0, Math.min(term.rows - 1, term.y));
+                term.wrapPending = false;
+            };
+
+            if (prefix === '?' && (final === 'h' || final === 'l')) {
+                const on = final === 'h';
+                args.forEach(mode => {
+                    if (mode === 1) term.appCursor = on;
+                    if (mode === 25) term.cursorVisible = on;
+                    if (mode === 2004) term.bracketedPaste = on;
+                    if (mode === 47 || mode === 1047) terminalSetAltScreen(term, on);
+                    if (mode === 1049) {
+                        if (on) term.saved = { x: term.x, y: term.y, style: term.style };
+                        terminalSetAltScreen(term, on);
+                        if (!on) terminalRestoreCursor(term);
+                    }
+                });
+                term.dirty.add(term.y);
+                return;
+            }
+            if (prefix !== '' && final !== 'c') return;
+
+            term.dirty.add(term.y);
+            switch (final) {
+                case 'A': term.y -= arg(0, 1); clampCursor(); break;
+                case 'B': case 'e': term.y += arg(0, 1); clampCursor(); break;
+                case 'C': case 'a': term.x += arg(0, 1); clampCursor(); break;
+                case 'D': term.x -= arg(0, 1); clampCursor(); break;
+                case 'E': term.y += arg(0, 1); term.x = 0; clampCursor(); break;
+                case 'F': term.y -= arg(0, 1); term.x = 0; clampCursor(); break;
+                case 'G': case '\x60': term.x = arg(0, 1) - 1; clampCursor(); break;
+                case 'd': term.y = arg(0, 1) - 1; clampCursor(); break;
+                case 'H': case 'f': term.y = arg(0, 1) - 1; term.x = arg(1, 1) - 1; clampCursor(); break;
+                case 'J':
+                    if (args[0] === 0) {
+                        terminalErase(term, term.y, term.x, term.cols);
+                        for (let y = term.y + 1; y < term.rows; y++) terminalErase(term, y, 0, term.cols);
+                    } else if (args[0] === 1) {
+                        for (let y = 0; y < term.y; y++) terminalErase(term, y, 0, term.cols);
+                        terminalErase(term, term.y, 0, term.x + 1);
+                    } else {
+                        for (let y = 0; y < term.rows; y++) terminalErase(term, y, 0, term.cols);
+                        if (args[0] === 3) term.historyEl.innerHTML = '';
+                    }
+                    break;
+                case 'K':
+                    if (args[0] === 0) terminalErase(term, term.y, term.x, term.cols);
+                    else if (args[0] === 1) terminalErase(term, term.y, 0, term.x + 1);
+                    else terminalErase(term, term.y, 0, term.cols);
+                    break;
+                case 'L':
+                case 'M':
+                    if (term.y >= term.top && term.y <= term.bottom) {
+                        const top = term.top;
+                        term.top = term.y;
+                        if (final === 'L') terminalScrollDown(term, Math.min(arg(0, 1), term.bottom - term.y + 1));
+                        else terminalScrollUp(term, Math.min(arg(0, 1), term.bottom - term.y + 1), false);
+                        term.top = top;
+                        term.x = 0;
+                    }
+                    break;
+                case '@': {
+                    const row = term.grid[term.y];
+                    const blanks = [];
+                    for (let i = 0; i < Math.min(arg(0, 1), term.cols - term.x); i++) blanks.push({ c: ' ', s: term.blank });
+                    row.splice(term.x, 0, ...blanks);
+                    row.length = term.cols;
+                    break;
+                }
+                case 'P': {
+                    const row = term.grid[term.y];
+                    const n = Math.min(arg(0, 1), term.cols - term.x);
+                    row.splice(term.x, n);
+                    for (let i = 0; i < n; i++) row.push({ c: ' ', s: term.blank });
+                    break;
+                }
+                case 'X': terminalErase(term, term.y, term.x, term.x + arg(0, 1)); break;
+                case 'S': terminalScrollUp(term, arg(0, 1), false); break;
+                case 'T': terminalScrollDown(term, arg(0, 1)); break;
+                case 'm': terminalSgr(term, args); break;
+                case 'r':
+                    term.top = Math.max(0, arg(0, 1) - 1);
+                    term.bottom = Math.min(term.rows - 1, arg(1, term.rows) - 1);
+                    if (term.top >= term.bottom) {
+                        term.top = 0;
+                        term.bottom = term.rows - 1;
+                    }
+                    term.x = 0;
+                    term.y = 0;
+                    break;
+                case 's': term.saved = { x: term.x, y: term.y, style: term.style }; break;
+                case 'u': terminalRestoreCursor(term); break;
+                case 'n':
+                    if (args[0] === 6) terminalSend(term, '\x1b[' + (term.y + 1) + ';' + (term.x + 1) + 'R');
+                    else if (args[0] === 5) terminalSend(term, '\x1b[0n');
+                    break;
+                case 'c':
+                    if (prefix === '') terminalSend(term, '\x1b[?1;2c');
+                    break;
+            }
+            term.dirty.add(term.y);
+        }
+
+        function terminalSgr(term, args) {
+            const style = Object.assign({}, term.style);
+            for (let i = 0; i < args.length; i++) {
+                const a = args[i];
+                if (a === 0) {
+                    Object.keys(style).forEach(k => delete style[k]);
+                } else if (a === 1) style.bold = true;
+                else if (a === 2) style.dim = true;
+                else if (a === 3) style.italic = true;
+                else if (a === 4) style.underline = true;
+                else if (a === 7) style.inverse = true;
+                else if (a === 22) { delete style.bold; delete style.dim; }
+                else if (a === 23) delete style.italic;
+                else if (a === 24) delete style.underline;
+                else if (a === 27) delete style.inverse;
+                else if (a >= 30 && a <= 37) style.fg = terminalPalette[a - 30];
+                else if (a >= 90 && a <= 97) style.fg = terminalPalette[a - 90 + 8];
+                else if (a === 39) delete style.fg;
+                else if (a >= 40 && a <= 47) style.bg = terminalPalette[a - 40];
+                else if (a >= 100 && a <= 107) style.bg = terminalPalette[a - 100 + 8];
+                else if (a === 49) delete style.bg;
+                else if (a === 38 || a === 48) {
+                    let color = null;
+                    if (args[i + 1] === 5) {
+                        color = terminalPalette[args[i + 2]] || null;
+                        i += 2;
+                    } else if (args[i + 1] === 2) {
+                        color = 'rgb(' + (args[i + 2] || 0) + ',' + (args[i + 3] || 0) + ',' + (args[i + 4] || 0) + ')';
+                        i += 4;
+                    }
+                    if (color) style[a === 38 ? 'fg' : 'bg'] = color;
+                }
+            }
+            term.style = Object.keys(style).length ? style : terminalDefaultStyle;
+            term.blank = style.bg ? { bg: style.bg } : terminalDefaultStyle;
+        }
+
+        function terminalCss(s) {
+            let fg = s.fg || '';
+            let bg = s.bg || '';
+            if (s.inverse) {
+                fg = s.bg || '#1e1e1e';
+                bg = s.fg || '#cccccc';
+            }
+            let css = '';
+            if (fg) css += 'color:' + fg + ';';
+            if (bg) css += 'background:' + bg + ';';
+            if (s.bold) css += 'font-weight:bold;';
+            if (s.dim) css += 'opacity:0.6;';
+            if (s.italic) css += 'font-style:italic;';
+            if (s.underline) css += 'text-decoration:underline;';
+            return css;
+        }
+
+        function terminalRowHtml(term, row, cursorX) {
+            const escape = (text) => text.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+            let end = row.length;
+            if (cursorX < 0) {
+                while (end > 0 && row[end - 1].c === ' ' && row[end - 1].s === terminalDefaultStyle) end--;
+            }
+
+            let html = '';
+            let run = '';
+            let runStyle = null;
+            const flush = () => {
+                if (run === '') return;
+                const css = terminalCss(runStyle);
+                html += css ? '<span style="' + css + '">' + escape(run) + '</span>' : escape(run);
+                run = '';
+            };
+            for (let x = 0; x < end; x++) {
+                const cell = row[x];
+                if (x === cursorX) {
+                    flush();
+                    html += '<span class="cursor">' + escape(cell.c) + '</span>';
+                    continue;
+                }
+                if (cell.s !== runStyle) {
+                    flush();
+                    runStyle = cell.s;
+                }
+                run += cell.c;
+            }
+            flush();
+            return html;
+        }
+
+        function terminalScheduleRender(term) {
+            if (term.renderPending) return;
+            term.renderPending = true;
+            requestAnimationFrame(() => {
+                term.renderPending = false;
+                const atBottom = term.el.scrollHeight - term.el.scrollTop - term.el.clientHeight < 30;
+                term.dirty.add(term.cursorY);
+                term.dirty.add(term.y);
+                term.cursorY = term.y;
+                term.dirty.forEach(y => {
+                    const line = term.screenEl.childNodes[y];
+                    if (!line || !term.grid[y]) return;
+                    const cursorX = term.cursorVisible && y === term.y ? term.x : -1;
+                    line.innerHTML = terminalRowHtml(term, term.grid[y], cursorX);
+                });
+                term.dirty.clear();
+                if (atBottom) term.el.scrollTop = term.el.scrollHeight;
+            });
+        }
+
+        let terminalFitTimer = null;
+        new ResizeObserver(() => {
+            clearTimeout(terminalFitTimer);
+            terminalFitTimer = setTimeout(() => {
+                if (activeTerminal) terminalFit(activeTerminal, true);
+            }, 100);
+        }).observe(document.getElementById('terminal-body'));
+
+        document.getElementById('terminal-resizer').addEventListener('mousedown', (e) => {
+            e.preventDefault();
+            const panel = document.getElementById('terminal-panel');
+            const startY = e.clientY;
+            const startHeight = panel.offsetHeight;
+            const move = (ev) => {
+                const max = document.getElementById('editor-container').clientHeight - 100;
+                panel.style.height = Math.max(80, Math.min(max, startHeight + startY - ev.clientY)) + 'px';
+            };
+            const up = () => {
+                document.removeEventListener('mousemove', move);
+                document.removeEventListener('mouseup', up);
+            };
+            document.addEventListener('mousemove', move);
+            document.addEventListener('mouseup', up);
+        });
 
-    <!-- Modal Connexion -->
-    <div id="connectModal" class="modal hidden">
-        <div class="modal-content">
-            <div class="modal-header">
-                <h2>Connexion SSH</h2>
-                <button class="modal-close" onclick="hideConnectModal()">×</button>
-            </div>
-            <div class="form-group">
-                <label>Type</label>
-                <select id="type">
-                    <option value="true">Dossier</option>
-                    <option value="false">Fichier</option>
-                </select>
-            </div>
-            <div class="form-group checkbox">
-                <input type="checkbox" id="useSudo">
-                <label for="useSudo">Utiliser sudo (fichiers système)</label>
-            </div>
-            <div class="form-group">
-                <label>Hôte</label>
-                <input type="text" id="host" placeholder="192.168.1.100">
-            </div>
-            <div class="form-group">
-                <label>Port</label>
-                <input type="text" id="port" value="22">
-            </div>
-            <div class="form-group">
-                <label>Utilisateur</label>
-                <input type="text" id="username" placeholder="root">
-            </div>
-            <div class="form-group">
-                <label>Mot de passe</label>
-                <input type="password" id="password">
-            </div>
-            <div class="form-group">
-                <label>Chemin</label>
-                <input type="text" id="path" placeholder="/root/project">
-            </div>
-            <div class="form-buttons">
-                <button onclick="hideConnectModal()">Annuler</button>
-                <button onclick="connect()" class="primary">Connecter</button>
-            </div>
-        </div>
-    </div>
+        // TÂCHES
+        let connectionTasks = [];
+        let taskEvents = null;
 
-    <!-- Modal Création -->
-    <div id="createModal" class="modal hidden">
-        <div class="modal-content">
-            <div class="modal-header">
-                <h2 id="createTitle">Nouveau fichier</h2>
-                <button class="modal-close" onclick="hideCreateModal()">×</button>
-            </div>
-            <div class="form-group">
-                <label>Nom</label>
-                <input type="text" id="createName" placeholder="fichier.txt">
-            </div>
-            <div class="form-buttons">
-                <button onclick="hideCreateModal()">Annuler</button>
-                <button onclick="createItem()" class="primary">Créer</button>
-            </div>
-        </div>
-    </div>
+        function showTasksModal() {
+            document.getElementById('tasksModal').classList.remove('hidden');
+            loadTasks();
+            loadTaskRuns();
+        }
+
+        function hideTasksModal() {
+            document.getElementById('tasksModal').classList.add('hidden');
+        }
+
+        async function loadTasks() {
+            const list = document.getElementById('taskList');
+            list.innerHTML = '';
+
+            try {
+                const res = await fetch('/api/tasks');
+                const result = await res.json();
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+
+                const data = result.data;
+                connectionTasks = data.connection;
+
+                const projectHeader = document.createElement('div');
+                projectHeader.className = 'list-section';
+                projectHeader.textContent = 'Projet · ' + data.projectFile;
+                list.appendChild(projectHeader);
+                if (data.projectError) {
+                    const error = document.createElement('div');
+                    error.className = 'list-row';
+                    error.style.color = 'var(--danger)';
+                    error.textContent = data.projectError;
+                    list.appendChild(error);
+                } else if (data.project.length === 0) {
+                    list.insertAdjacentHTML('beforeend', '<div class="empty">Aucune tâche de projet</div>');
+                }
+                data.project.forEach(task => list.appendChild(renderTaskRow(task)));
+
+                const connectionHeader = document.createElement('div');
+                connectionHeader.className = 'list-section';
+                connectionHeader.textContent = 'Connexion · ' + document.getElementById('connection-info').textContent;
+                list.appendChild(connectionHeader);
+                if (data.connection.length === 0) {
+                    list.insertAdjacentHTML('beforeend', '<div class="empty">Aucune tâche de connexion</div>');
+                }
+                data.connection.forEach(task => list.appendChild(renderTaskRow(task)));
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function renderTaskRow(task) {
+            const row = document.createElement('div');
+            row.className = 'list-row';
+
+            const name = document.createElement('span');
+            name.className = 'name';
+            name.textContent = task.name;
+            name.title = task.command;
+            row.appendChild(name);
+
+            const meta = document.createElement('span');
+            meta.className = 'meta';
+            meta.textContent = (task.sudo && task.source === 'connection' ? 'sudo · ' : '') + task.command + (task.dir ? ' · ' + task.dir : '');
+            row.appendChild(meta);
+
+            const run = document.createElement('button');
+            run.textContent = '▶ Exécuter';
+            run.onclick = () => runTask(task);
+            row.appendChild(run);
+
+            if (task.source === 'connection') {
+                const remove = document.createElement('button');
+                remove.className = 'danger';
+                remove.textContent = 'Supprimer';
+                remove.onclick = () => {
+                    if (confirm('Supprimer la tâche ' + task.name + ' ?')) {
+                        saveTasks(connectionTasks.filter(t => t.name !== task.name));
+                    }
+                };
+                row.appendChild(remove);
+            }
+            return row;
+        }
+
+        function addTask() {
+            const task = {
+                name: document.getElementById('taskName').value.trim(),
+                command: document.getElementById('taskCommand').value.trim(),
+                dir: document.getElementById('taskDir').value.trim(),
+                sudo: document.getElementById('taskSudo').checked
+            };
+            if (!task.name || !task.command) {
+                showNotification('Nom et commande requis', 'error');
+                return;
+            }
+            saveTasks(connectionTasks.filter(t => t.name !== task.name).concat([task]), () => {
+                document.getElementById('taskName').value = '';
+                document.getElementById('taskCommand').value = '';
+                document.getElementById('taskDir').value = '';
+                document.getElementById('taskSudo').checked = false;
+            });
+        }
+
+        async function saveTasks(tasks, onSaved) {
+            try {
+                const res = await fetch('/api/tasks/save', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({ tasks: tasks })
+                });
+                const result = await res.json();
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                if (onSaved) onSaved();
+                loadTasks();
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        // Retire les séquences de couleur et de contrôle du terminal
+        function stripAnsi(text) {
+            return text.replace(/\x1b\[[0-9;?]*[ -\/]*[@-~]|\x1b\][^\x07]*\x07|\x1b[()][0-9A-Za-z]/g, '');
+        }
+
+        function appendTaskOutput(stream, data) {
+            const output = document.getElementById('taskOutput');
+            const atBottom = output.scrollHeight - output.scrollTop - output.clientHeight < 30;
+            const chunk = document.createElement('span');
+            if (stream === 'stderr') chunk.className = 'stderr';
+            chunk.textContent = stripAnsi(data);
+            output.appendChild(chunk);
+            if (atBottom) output.scrollTop = output.scrollHeight;
+        }
+
+        function describeTaskRun(run) {
+            const parts = [];
+            if (run.end) {
+                parts.push(((new Date(run.end) - new Date(run.start)) / 1000).toFixed(1) + ' s');
+            }
+            if (run.cancelled) {
+                parts.push('annulée');
+            } else if (run.error) {
+                parts.push(run.error);
+            } else if (run.code !== undefined) {
+                parts.push('code ' + run.code);
+            } else {
+                parts.push(taskEvents && taskEvents.runId === run.id ? 'en cours' : 'interrompue');
+            }
+            if (run.truncated) parts.push('sortie tronquée');
+            return parts.join(' · ');
+        }
+
+        function runTask(task) {
+            if (taskEvents) {
+                showNotification('Une tâche est déjà en cours', 'error');
+                return;
+            }
+
+            const output = document.getElementById('taskOutput');
+            const summary = document.getElementById('taskSummary');
+            const stopBtn = document.getElementById('taskStopBtn');
+            output.innerHTML = '';
+            output.classList.remove('hidden');
+            summary.textContent = '▶ ' + task.name + '...';
+            stopBtn.disabled = false;
+            updateStatus('Tâche ' + task.name + '...', true);
+
+            const params = new URLSearchParams({ source: task.source, name: task.name });
+            taskEvents = postEventStream('/api/tasks/run?' + params.toString());
+
+            taskEvents.addEventListener('start', (e) => {
+                const run = JSON.parse(e.data);
+                taskEvents.runId = run.id;
+                summary.textContent = '▶ ' + run.name + ' · ' + run.command + ' · ' + run.dir;
+                loadTaskRuns();
+            });
+
+            taskEvents.addEventListener('output', (e) => {
+                const chunk = JSON.parse(e.data);
+                appendTaskOutput(chunk.stream, chunk.data);
+            });
+
+            taskEvents.addEventListener('done', (e) => {
+                const run = JSON.parse(e.data);
+                taskEvents.close();
+                taskEvents = null;
+                stopBtn.disabled = true;
+                updateStatus(currentFile || 'Prêt');
+                if (run.error && !run.id) {
+                    summary.textContent = '';
+                    showNotification(run.error, 'error');
+                    return;
+                }
+                const ok = run.code === 0 && !run.error;
+                summary.textContent = (ok ? '✓ ' : '✗ ') + run.name + ' · ' + describeTaskRun(run);
+                showNotification(run.name + ' : ' + describeTaskRun(run), ok ? 'success' : 'error');
+                loadTaskRuns();
+            });
+
+            taskEvents.onerror = () => {
+                if (!taskEvents) return;
+                taskEvents.close();
+                taskEvents = null;
+                stopBtn.disabled = true;
+                updateStatus(currentFile || 'Prêt');
+                showNotification('Tâche interrompue', 'error');
+                loadTaskRuns();
+            };
+        }
+
+        // Fermer le flux arrête la tâche sur le serveur
+        function stopTask() {
+            if (!taskEvents) return;
+            taskEvents.close();
+            taskEvents = null;
+            document.getElementById('taskStopBtn').disabled = true;
+            document.getElementById('taskSummary').textContent += ' · arrêt demandé';
+            updateStatus(currentFile || 'Prêt');
+            setTimeout(loadTaskRuns, 1500);
+        }
+
+        async function loadTaskRuns() {
+            const list = document.getElementById('taskRuns');
+
+            try {
+                const res = await fetch('/api/tasks/runs');
+                const result = await res.json();
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+
+                list.innerHTML = '';
+                if (result.data.length === 0) {
+                    list.innerHTML = '<div class="empty">Aucune exécution</div>';
+                    return;
+                }
+
+                result.data.forEach(run => {
+                    const row = document.createElement('div');
+                    row.className = 'list-row';
+
+                    const status = run.code === 0 && !run.error ? '✓' : (run.end ? '✗' : '…');
+                    const name = document.createElement('span');
+                    name.className = 'name';
+                    name.textContent = status + ' ' + run.name;
+                    name.title = run.command + ' · ' + run.dir;
+                    row.appendChild(name);
+
+                    const meta = document.createElement('span');
+                    meta.className = 'meta';
+                    meta.textContent = new Date(run.start).toLocaleString() + ' · ' + run.user + ' · ' + describeTaskRun(run);
+                    row.appendChild(meta);
+
+                    const show = document.createElement('button');
+                    show.textContent = 'Sortie';
+                    show.onclick = () => showTaskRun(run.id);
+                    row.appendChild(show);
+
+                    list.appendChild(row);
+                });
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        async function showTaskRun(id) {
+            if (taskEvents) {
+                showNotification('Une tâche est en cours', 'error');
+                return;
+            }
+
+            try {
+                const res = await fetch('/api/tasks/runs/output?id=' + encodeURIComponent(id));
+                const result = await res.json();
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+
+                const run = result.data.run;
+                const output = document.getElementById('taskOutput');
+                output.innerHTML = '';
+                output.classList.remove('hidden');
+                result.data.output.forEach(chunk => appendTaskOutput(chunk.stream, chunk.data));
+                document.getElementById('taskSummary').textContent = run.name + ' · ' + new Date(run.start).toLocaleString() + ' · ' + describeTaskRun(run);
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        // ARCHIVES
+        const archivePattern = /\.(tar\.gz|tgz|tar\.bz2|tbz2|tar\.xz|txz|tar|zip)$/i;
+        let archiveEvents = null;
+
+        // Renvoie le nom sans l'extension d'archive, ou '' si ce n'en est pas une
+        function archiveBaseName(name) {
+            const base = name.replace(archivePattern, '');
+            return base !== name && base !== '' ? base : '';
+        }
+
+        function createArchive(path, format) {
+            const name = prompt("Nom de l'archive :", path.split('/').pop() + '.' + format);
+            if (!name) return;
+            const params = new URLSearchParams({ path: path, format: format, name: name });
+            runArchiveTask('Compression de ' + path, '/api/archive/create?' + params.toString(), 'Archive créée : ');
+        }
+
+        function extractArchive(path, here, overwrite) {
+            const params = new URLSearchParams({ path: path, into: here ? 'here' : 'folder' });
+            if (overwrite) params.set('overwrite', '1');
+            runArchiveTask('Extraction de ' + path, '/api/archive/extract?' + params.toString(), 'Extrait dans ', (done) => {
+                let message = done.conflictCount + ' fichier(s) existent déjà dans le dossier :\n\n' + done.conflicts.join('\n');
+                if (done.conflictCount > done.conflicts.length) message += '\n…';
+                if (confirm(message + '\n\nLes remplacer ?')) extractArchive(path, here, true);
+            });
+        }
+
+        function runArchiveTask(title, url, successPrefix, onConflicts) {
+            if (archiveEvents) archiveEvents.close();
+            
+            const bar = document.getElementById('archiveProgress');
+            const count = document.getElementById('archiveCount');
+            const current = document.getElementById('archiveCurrent');
+            const stopBtn = document.getElementById('archiveStopBtn');
+            document.getElementById('archiveTitle').textContent = title;
+            bar.style.width = '0';
+            count.textContent = 'Préparation...';
+            current.textContent = '';
+            stopBtn.textContent = 'Annuler';
+            document.getElementById('archiveModal').classList.remove('hidden');
+            updateStatus(title + '...', true);
+            
+            archiveEvents = postEventStream(url);
+            
+            archiveEvents.addEventListener('progress', (e) => {
+                const progress = JSON.parse(e.data);
+                if (progress.total > 0) {
+                    bar.style.width = Math.min(100, 100 * progress.done / progress.total) + '%';
+                    count.textContent = progress.done + ' / ' + progress.total + ' élément(s)';
+                } else {
+                    count.textContent = progress.done + ' élément(s)';
+                }
+                current.textContent = progress.current || '';
+            });
+            
+            archiveEvents.addEventListener('done', (e) => {
+                const done = JSON.parse(e.data);
+                archiveEvents.close();
+                archiveEvents = null;
+                stopBtn.textContent = 'Fermer';
+                current.textContent = '';
+                updateStatus(currentFile || 'Prêt');
+                loadTree();
+                if (done.conflicts && onConflicts) {
+                    count.textContent = done.error;
+                    onConflicts(done);
+                    return;
+                }
+                if (done.error) {
+                    count.textContent = done.error;
+                    showNotification(done.error, 'error');
+                    return;
+                }
+                bar.style.width = '100%';
+                count.textContent = done.count + ' élément(s) · ' + done.path;
+                showNotification(successPrefix + done.path, 'success');
+            });
+            
+            archiveEvents.onerror = () => {
+                if (!archiveEvents) return;
+                archiveEvents.close();
+                archiveEvents = null;
+                stopBtn.textContent = 'Fermer';
+                updateStatus(currentFile || 'Prêt');
+                showNotification('Opération interrompue', 'error');
+            };
+        }
+
+        // Fermer la connexion interrompt la commande sur le serveur
+        function stopArchiveTask() {
+            if (archiveEvents) {
+                archiveEvents.close();
+                archiveEvents = null;
+                updateStatus(currentFile || 'Prêt');
+                showNotification('Opération annulée', 'error');
+                loadTree();
+            }
+            document.getElementById('archiveModal').classList.add('hidden');
+        }
+
+        // SYNCHRONISATION
+        function showSyncModal(path) {
+            document.getElementById('syncRemote').value = path;
+            document.getElementById('syncSummary').textContent = '';
+            document.getElementById('syncList').classList.add('hidden');
+            document.getElementById('syncModal').classList.remove('hidden');
+            document.getElementById('syncLocal').focus();
+        }
+
+        function hideSyncModal() {
+            document.getElementById('syncModal').classList.add('hidden');
+        }
+
+        async function runSync(dryRun) {
+            const mode = document.getElementById('syncMode').value;
+            if (!dryRun) {
+                const warning = mode === 'mirror' ? '\n\nLes fichiers du serveur absents en local seront supprimés.' : '';
+                if (!confirm('Lancer la synchronisation ?' + warning)) return;
+            }
+            
+            const summary = document.getElementById('syncSummary');
+            summary.textContent = dryRun ? 'Analyse...' : 'Synchronisation...';
+            updateStatus(summary.textContent, true);
+            
+            try {
+                const res = await fetch('/api/sync', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify({
+                        local: document.getElementById('syncLocal').value,
+                        remote: document.getElementById('syncRemote').value,
+                        mode: mode,
+                        compare: document.getElementById('syncCompare').value,
+                        ignore: document.getElementById('syncIgnore').value.split(',').map(v => v.trim()).filter(v => v),
+                        dryRun: dryRun
+                    })
+                });
+                const result = await res.json();
+                updateStatus(currentFile || 'Prêt');
+                
+                if (!result.success) {
+                    summary.textContent = '';
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                const data = result.data;
+                const bytes = data.actions.filter(a => a.action === 'upload' || a.action === 'download').reduce((n, a) => n + a.size, 0);
+                summary.textContent = data.local + ' ⇄ ' + data.remote + ' · ' + (dryRun
+                    ? data.actions.length + ' action(s) prévue(s), ' + formatBytes(bytes) + ' à transférer'
+                    : result.message + ', ' + formatBytes(data.transferred) + ' transférés');
+                renderSyncActions(data.actions);
+                
+                if (!dryRun) {
+                    showNotification(result.message, data.failed ? 'error' : 'success');
+                    if (mode !== 'pull') loadTree();
+                }
+            } catch (e) {
+                summary.textContent = '';
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function renderSyncActions(actions) {
+            const list = document.getElementById('syncList');
+            list.innerHTML = '';
+            list.classList.remove('hidden');
+            if (actions.length === 0) {
+                list.innerHTML = '<div class="empty">Déjà synchronisé</div>';
+                return;
+            }
+            
+            const labels = { upload: '⇧ envoi', download: '⇩ récupération', mkdir: '□ dossier', delete: '× suppression', skip: '– ignoré' };
+            actions.forEach(action => {
+                const row = document.createElement('div');
+                row.className = 'list-row';
+                
+                const kind = document.createElement('span');
+                kind.className = 'meta';
+                kind.textContent = labels[action.action] || action.action;
+                row.appendChild(kind);
+                
+                const name = document.createElement('span');
+                name.className = 'name';
+                name.textContent = action.path;
+                row.appendChild(name);
+                
+                const meta = document.createElement('span');
+                meta.className = 'meta';
+                meta.textContent = action.error ? '⚠ ' + action.error : [action.reason, action.size ? formatBytes(action.size) : ''].filter(v => v).join(' · ');
+                if (action.error) meta.style.color = 'var(--danger)';
+                row.appendChild(meta);
+                
+                list.appendChild(row);
+            });
+        }
+
+        // OUVERTURE RAPIDE
+        function showQuickOpen() {
+            if (!document.getElementById('connection-info').textContent) return;
+            document.getElementById('quickOpenModal').classList.remove('hidden');
+            const input = document.getElementById('quickOpenInput');
+            input.value = '';
+            input.focus();
+            queryQuickOpen();
+        }
+
+        function hideQuickOpen() {
+            document.getElementById('quickOpenModal').classList.add('hidden');
+            document.getElementById('editor').focus();
+        }
+
+        async function queryQuickOpen() {
+            const seq = ++quickOpenSeq;
+            const query = document.getElementById('quickOpenInput').value;
+            try {
+                const res = await fetch('/api/quickopen?q=' + encodeURIComponent(query));
+                const result = await res.json();
+                if (seq !== quickOpenSeq) return;
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                quickOpenResults = result.data.results || [];
+                quickOpenActive = 0;
+                renderQuickOpen();
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function renderQuickOpen() {
+            const list = document.getElementById('quickOpenList');
+            list.innerHTML = '';
+            if (quickOpenResults.length === 0) {
+                list.innerHTML = '<div class="empty">Aucun fichier correspondant</div>';
+                return;
+            }
+            
+            quickOpenResults.forEach((item, i) => {
+                const row = document.createElement('div');
+                row.className = 'quick-item' + (i === quickOpenActive ? ' active' : '');
+                
+                const relPath = item.dir ? item.dir + '/' + item.name : item.name;
+                const positions = new Set(item.positions || []);
+                const offset = item.inName ? 0 : Array.from(relPath).length - Array.from(item.name).length;
+                
+                const name = document.createElement('span');
+                appendHighlighted(name, item.name, positions, offset);
+                row.appendChild(name);
+                
+                const dir = document.createElement('span');
+                dir.className = 'dir';
+                if (item.inName) {
+                    dir.textContent = item.dir;
+                } else {
+                    appendHighlighted(dir, item.dir, positions, 0);
+                }
+                row.appendChild(dir);
+                
+                row.onclick = () => openQuickResult(i);
+                row.onmousemove = () => {
+                    if (quickOpenActive !== i) {
+                        quickOpenActive = i;
+                        renderQuickOpen();
+                    }
+                };
+                list.appendChild(row);
+            });
+            
+            const active = list.children[quickOpenActive];
+            if (active) active.scrollIntoView({ block: 'nearest' });
+        }
+
+        function appendHighlighted(container, text, positions, offset) {
+            Array.from(text).forEach((ch, i) => {
+                if (positions.has(i + offset)) {
+                    const b = document.createElement('b');
+                    b.textContent = ch;
+                    container.appendChild(b);
+                } else {
+                    container.appendChild(document.createTextNode(ch));
+                }
+            });
+        }
 
-    <script>
-        let currentFile = '';
-        let expandedFolders = new Set();
-        let createType = 'file';
-        let contextMenuTarget = null;
+        function openQuickResult(i) {
+            const item = quickOpenResults[i];
+            if (!item) return;
+            hideQuickOpen();
+            if (item.path === currentFile) return;
+            if (dirty && !confirm('Vos modifications non sauvegardées seront perdues. Continuer ?')) return;
+            loadFile(item.path);
+        }
 
-        // CONNEXION
-        function showConnectModal() {
-            document.getElementById('connectModal').classList.remove('hidden');
+        // RECHERCHE
+        function showSearchModal() {
+            document.getElementById('searchModal').classList.remove('hidden');
+            const query = document.getElementById('searchQuery');
+            query.focus();
+            query.select();
         }
 
-        function hideConnectModal() {
-            document.getElementById('connectModal').classList.add('hidden');
+        function hideSearchModal() {
+            stopSearch();
+            document.getElementById('searchModal').classList.add('hidden');
         }
 
-        async function connect() {
-            const data = {
-                host: document.getElementById('host').value,
-                port: document.getElementById('port').value,
-                username: document.getElementById('username').value,
-                password: document.getElementById('password').value,
-                path: document.getElementById('path').value,
-                isDir: document.getElementById('type').value === 'true',
-                useSudo: document.getElementById('useSudo').checked
+        function stopSearch() {
+            if (searchEvents) {
+                searchEvents.close();
+                searchEvents = null;
+                document.getElementById('searchSummary').textContent += ' (arrêtée)';
+            }
+            document.getElementById('searchStopBtn').disabled = true;
+        }
+
+        function startSearch() {
+            const query = document.getElementById('searchQuery').value;
+            if (!query) return;
+            stopSearch();
+            
+            const params = new URLSearchParams({
+                q: query,
+                regex: document.getElementById('searchRegex').checked ? '1' : '0',
+                case: document.getElementById('searchCase').checked ? '1' : '0',
+                ignore: document.getElementById('searchIgnore').value,
+                maxSize: String(Math.round(parseFloat(document.getElementById('searchMaxSize').value || '1024') * 1024))
+            });
+            
+            const results = document.getElementById('searchResults');
+            const summary = document.getElementById('searchSummary');
+            results.innerHTML = '';
+            summary.textContent = 'Recherche...';
+            let lastFile = '';
+            let count = 0;
+            
+            searchEvents = new EventSource('/api/search?' + params.toString());
+            document.getElementById('searchStopBtn').disabled = false;
+            
+            searchEvents.addEventListener('match', (e) => {
+                const match = JSON.parse(e.data);
+                if (match.file !== lastFile) {
+                    lastFile = match.file;
+                    const header = document.createElement('div');
+                    header.className = 'search-file';
+                    header.textContent = match.file;
+                    results.appendChild(header);
+                }
+                results.appendChild(renderSearchMatch(match));
+                count++;
+                summary.textContent = count + ' résultat(s)...';
+            });
+            
+            searchEvents.addEventListener('done', (e) => {
+                const done = JSON.parse(e.data);
+                searchEvents.close();
+                searchEvents = null;
+                document.getElementById('searchStopBtn').disabled = true;
+                if (done.error) {
+                    summary.textContent = '';
+                    showNotification(done.error, 'error');
+                    return;
+                }
+                summary.textContent = done.count + ' résultat(s)' + (done.truncated ? ' (limite atteinte)' : '') + ' · ' + done.backend;
+                if (done.count === 0) {
+                    results.innerHTML = '<div class="empty">Aucun résultat</div>';
+                }
+            });
+            
+            searchEvents.onerror = () => {
+                if (!searchEvents) return;
+                searchEvents.close();
+                searchEvents = null;
+                document.getElementById('searchStopBtn').disabled = true;
+                showNotification('Recherche interrompue', 'error');
             };
+        }
 
-            if (!data.host || !data.username || !data.password || !data.path) {
-                showNotification('Tous les champs sont requis', 'error');
-                return;
-            }
+        function replaceOptions() {
+            return {
+                pattern: document.getElementById('searchQuery').value,
+                replacement: document.getElementById('replaceWith').value,
+                regex: document.getElementById('searchRegex').checked,
+                case: document.getElementById('searchCase').checked,
+                ignore: document.getElementById('searchIgnore').value,
+                maxSize: Math.round(parseFloat(document.getElementById('searchMaxSize').value || '1024') * 1024)
+            };
+        }
 
-            updateStatus('Connexion...', true);
+        async function previewReplace() {
+            const options = replaceOptions();
+            if (!options.pattern) return;
+            stopSearch();
+            updateStatus('Préparation du remplacement...', true);
             
             try {
-                const res = await fetch('/api/connect', {
+                const res = await fetch('/api/replace/preview', {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify(data)
+                    body: JSON.stringify(options)
                 });
                 const result = await res.json();
+                updateStatus(currentFile || 'Prêt');
                 
-                if (result.success) {
-                    hideConnectModal();
-                    document.getElementById('connection-info').textContent = data.username + '@' + data.host;
-                    showNotification('Connecté avec succès', 'success');
-                    updateStatus('Connecté');
-                    loadTree();
-                } else {
+                if (!result.success) {
                     showNotification(result.message, 'error');
-                    updateStatus('Échec');
+                    return;
                 }
+                
+                replacePreview = { options: options, files: result.data.files };
+                document.getElementById('replaceTitle').textContent = 'Remplacer · ' + result.data.total + ' occurrence(s)' + (result.data.truncated ? ' (liste tronquée)' : '');
+                document.getElementById('replaceDiff').classList.add('hidden');
+                renderReplacePreview();
+                document.getElementById('searchModal').classList.add('hidden');
+                document.getElementById('replaceModal').classList.remove('hidden');
             } catch (e) {
                 showNotification('Erreur: ' + e.message, 'error');
-                updateStatus('Erreur');
             }
         }
 
-        // ARBORESCENCE
-        async function loadTree() {
-            updateStatus('Chargement...', true);
-            const res = await fetch('/api/tree');
-            const result = await res.json();
-            if (result.success) {
-                renderTree(result.data, document.getElementById('tree'));
-                updateStatus('Prêt');
-            } else {
-                updateStatus('Erreur');
+        function renderReplacePreview() {
+            const list = document.getElementById('replaceList');
+            list.innerHTML = '';
+            if (replacePreview.files.length === 0) {
+                list.innerHTML = '<div class="empty">Aucune occurrence à remplacer</div>';
+                document.getElementById('replaceApplyBtn').disabled = true;
+                return;
             }
+            document.getElementById('replaceApplyBtn').disabled = false;
+            
+            replacePreview.files.forEach(file => {
+                const row = document.createElement('div');
+                row.className = 'list-row';
+                
+                const box = document.createElement('input');
+                box.type = 'checkbox';
+                box.checked = !file.error;
+                box.disabled = !!file.error;
+                box.onchange = () => { file.skip = !box.checked; };
+                file.skip = !!file.error;
+                row.appendChild(box);
+                
+                const name = document.createElement('span');
+                name.className = 'name';
+                name.textContent = file.path;
+                row.appendChild(name);
+                
+                const meta = document.createElement('span');
+                meta.className = 'meta';
+                meta.textContent = file.error ? file.error : file.count + ' occurrence(s)';
+                row.appendChild(meta);
+                
+                if (file.diff) {
+                    const show = document.createElement('button');
+                    show.textContent = 'Δ';
+                    show.title = 'Voir les modifications';
+                    show.onclick = () => {
+                        const view = document.getElementById('replaceDiff');
+                        renderDiff(view, file.diff.unified);
+                        view.classList.remove('hidden');
+                    };
+                    row.appendChild(show);
+                }
+                
+                list.appendChild(row);
+            });
         }
 
-        function renderTree(nodes, container) {
-            container.innerHTML = '';
-            nodes.forEach(node => {
-                renderNode(node, container, 0);
-            });
+        function hideReplaceModal() {
+            replacePreview = null;
+            document.getElementById('replaceModal').classList.add('hidden');
         }
 
-        function renderNode(node, container, level) {
-            const div = document.createElement('div');
-            div.className = 'tree-item ' + (node.isDir ? 'folder' : 'file');
-            div.style.paddingLeft = (level * 16 + 12) + 'px';
-            div.dataset.path = node.path;
-            div.dataset.isDir = node.isDir;
-            
-            if (node.isDir) {
-                div.classList.add(expandedFolders.has(node.path) ? 'expanded' : 'collapsed');
-            }
+        async function applyReplace() {
+            if (!replacePreview) return;
+            const files = replacePreview.files.filter(file => !file.skip).map(file => ({ path: file.path, version: file.version }));
+            if (files.length === 0) return;
+            if (!confirm('Appliquer le remplacement dans ' + files.length + ' fichier(s) ?')) return;
             
-            const icon = document.createElement('span');
-            icon.className = 'icon';
-            if (!node.isDir) {
-                icon.textContent = getFileIcon(node.name);
+            updateStatus('Remplacement...', true);
+            try {
+                const res = await fetch('/api/replace/apply', {
+                    method: 'POST',
+                    headers: {'Content-Type': 'application/json'},
+                    body: JSON.stringify(Object.assign({}, replacePreview.options, { files: files }))
+                });
+                const result = await res.json();
+                updateStatus(currentFile || 'Prêt');
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                hideReplaceModal();
+                const failed = result.data.failed || [];
+                showNotification(result.message, failed.length ? 'error' : 'success');
+                if (failed.length) {
+                    alert('Fichiers non modifiés :\n\n' + failed.map(f => f.path + ' : ' + f.error).join('\n'));
+                }
+                
+                const current = (result.data.applied || []).find(f => f.path === currentFile);
+                if (current) {
+                    if (dirty) {
+                        showNotification('Le fichier ouvert a été modifié par le remplacement, vos modifications sont en conflit', 'error');
+                    } else {
+                        lastSaveAt = Date.now();
+                        loadFile(currentFile);
+                    }
+                }
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
             }
-            div.appendChild(icon);
-            
-            const name = document.createElement('span');
-            name.className = 'name';
-            name.textContent = node.name;
-            div.appendChild(name);
+        }
+
+        function renderSearchMatch(match) {
+            const row = document.createElement('div');
+            row.className = 'search-match';
+            row.title = match.file + ':' + match.line + ':' + match.column;
             
-            div.onclick = (e) => {
-                e.stopPropagation();
-                if (node.isDir) {
-                    toggleFolder(node.path);
+            const addLine = (num, text, isMatch) => {
+                const line = document.createElement('div');
+                if (!isMatch) {
+                    line.className = 'context';
+                    line.textContent = String(num).padStart(5) + '  ' + text;
                 } else {
-                    loadFile(node.path);
+                    line.appendChild(document.createTextNode(String(num).padStart(5) + ': '));
+                    highlightMatch(line, text);
                 }
+                row.appendChild(line);
             };
             
-            div.oncontextmenu = (e) => {
-                e.preventDefault();
-                showContextMenu(e, node.path, node.isDir);
-            };
-            
-            container.appendChild(div);
+            (match.before || []).forEach((text, i, all) => addLine(match.line - all.length + i, text, false));
+            addLine(match.line, match.text, true);
+            (match.after || []).forEach((text, i) => addLine(match.line + 1 + i, text, false));
             
-            if (node.isDir && node.children && expandedFolders.has(node.path)) {
-                const childContainer = document.createElement('div');
-                childContainer.className = 'tree-children';
-                node.children.forEach(child => {
-                    renderNode(child, childContainer, level + 1);
-                });
-                container.appendChild(childContainer);
+            row.onclick = async () => {
+                hideSearchModal();
+                if (dirty && currentFile !== match.file && !confirm('Vos modifications non sauvegardées seront perdues. Continuer ?')) return;
+                if (currentFile !== match.file) await loadFile(match.file, true);
+                goToLine(match.line, match.column);
+            };
+            return row;
+        }
+
+        function highlightMatch(container, text) {
+            const query = document.getElementById('searchQuery').value;
+            let pattern;
+            try {
+                const source = document.getElementById('searchRegex').checked ? query : query.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+                pattern = new RegExp(source, document.getElementById('searchCase').checked ? '' : 'i');
+            } catch (e) {
+                pattern = null;
+            }
+            const found = pattern ? pattern.exec(text) : null;
+            if (!found || found[0] === '') {
+                container.appendChild(document.createTextNode(text));
+                return;
             }
+            const mark = document.createElement('mark');
+            mark.textContent = found[0];
+            container.appendChild(document.createTextNode(text.substring(0, found.index)));
+            container.appendChild(mark);
+            container.appendChild(document.createTextNode(text.substring(found.index + found[0].length)));
         }
 
-        function toggleFolder(path) {
-            if (expandedFolders.has(path)) {
-                expandedFolders.delete(path);
-            } else {
-                expandedFolders.add(path);
+        function goToLine(line, column) {
+            const editor = document.getElementById('editor');
+            if (viewer) return;
+            const lines = editor.value.split('\n');
+            let offset = 0;
+            for (let i = 0; i < line - 1 && i < lines.length; i++) {
+                offset += lines[i].length + 1;
             }
-            loadTree();
+            offset += Math.max(0, (column || 1) - 1);
+            editor.focus();
+            editor.setSelectionRange(offset, offset);
+            const lineHeight = parseFloat(getComputedStyle(editor).lineHeight) || 20;
+            editor.scrollTop = Math.max(0, (line - 5) * lineHeight);
         }
 
-        function getFileIcon(filename) {
-            const ext = filename.split('.').pop().toLowerCase();
-            const icons = {
-                'js': '≡', 'json': '{ }', 'html': '< >', 'css': '#',
-                'py': 'py', 'go': 'go', 'java': 'j', 'php': 'php',
-                'md': 'md', 'txt': 'txt', 'pdf': 'pdf', 'zip': 'zip',
-                'jpg': 'img', 'png': 'img', 'gif': 'img', 'svg': 'svg',
-                'mp3': '♪', 'mp4': '▶', 'sh': 'sh', 'log': 'log'
-            };
-            return icons[ext] || '•';
+        // CORBEILLE
+        function showTrashModal() {
+            document.getElementById('trashModal').classList.remove('hidden');
+            loadTrash();
         }
 
-        // FICHIERS
-        async function loadFile(path) {
-            updateStatus('Chargement...', true);
+        function hideTrashModal() {
+            document.getElementById('trashModal').classList.add('hidden');
+        }
+
+        async function loadTrash() {
+            const list = document.getElementById('trashList');
+            list.innerHTML = '';
             
             try {
-                const res = await fetch('/api/file?path=' + encodeURIComponent(path));
+                const res = await fetch('/api/trash');
                 const result = await res.json();
                 
-                if (result.success) {
-                    currentFile = path;
-                    const editor = document.getElementById('editor');
-                    editor.value = result.data.content;
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                if (result.data.length === 0) {
+                    list.innerHTML = '<div class="empty">La corbeille est vide</div>';
+                    return;
+                }
+                
+                result.data.forEach(item => {
+                    const row = document.createElement('div');
+                    row.className = 'list-row';
                     
-                    document.getElementById('current-file').textContent = path.split('/').pop();
-                    document.getElementById('file-size').textContent = formatBytes(result.data.size);
-                    document.getElementById('saveBtn').disabled = false;
+                    const name = document.createElement('span');
+                    name.className = 'name';
+                    name.textContent = (item.isDir ? '□ ' : '') + item.originalPath;
+                    name.title = item.originalPath;
+                    row.appendChild(name);
                     
-                    const lang = detectLanguage(path);
-                    document.getElementById('language-info').textContent = lang.toUpperCase();
+                    const meta = document.createElement('span');
+                    meta.className = 'meta';
+                    meta.textContent = new Date(item.deletedAt).toLocaleString() + (item.isDir ? '' : ' · ' + formatBytes(item.size));
+                    row.appendChild(meta);
                     
-                    updateStatus(path);
+                    const restore = document.createElement('button');
+                    restore.textContent = 'Restaurer';
+                    restore.onclick = () => restoreTrash(item.id);
+                    row.appendChild(restore);
                     
-                    document.querySelectorAll('.tree-item').forEach(el => {
-                        el.classList.remove('selected');
-                        if (el.dataset.path === path) {
-                            el.classList.add('selected');
-                        }
-                    });
-                } else {
-                    showNotification(result.message, 'error');
-                }
+                    const purge = document.createElement('button');
+                    purge.className = 'danger';
+                    purge.textContent = 'Supprimer';
+                    purge.onclick = () => purgeTrash(item.id);
+                    row.appendChild(purge);
+                    
+                    list.appendChild(row);
+                });
             } catch (e) {
                 showNotification('Erreur: ' + e.message, 'error');
             }
         }
 
-        async function saveFile() {
-            if (!currentFile) return;
-            
-            updateStatus('Sauvegarde...', true);
-            
+        async function restoreTrash(id) {
             try {
-                const res = await fetch('/api/save', {
+                const res = await fetch('/api/trash/restore', {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify({
-                        path: currentFile,
-                        content: document.getElementById('editor').value
-                    })
+                    body: JSON.stringify({ id: id })
                 });
                 const result = await res.json();
                 
                 if (result.success) {
-                    showNotification('Fichier sauvegardé', 'success');
-                    updateStatus('Sauvegardé');
-                    setTimeout(() => updateStatus(currentFile), 2000);
+                    showNotification('Restauré: ' + result.data.originalPath, 'success');
+                    loadTrash();
+                    loadTree();
                 } else {
                     showNotification(result.message, 'error');
                 }
@@ -986,40 +4847,21 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             }
         }
 
-        // CRÉATION
-        function showCreateModal(type) {
-            createType = type;
-            document.getElementById('createTitle').textContent = type === 'file' ? 'Nouveau fichier' : 'Nouveau dossier';
-            document.getElementById('createName').value = '';
-            document.getElementById('createModal').classList.remove('hidden');
-        }
-
-        function hideCreateModal() {
-            document.getElementById('createModal').classList.add('hidden');
-        }
-
-        async function createItem() {
-            const name = document.getElementById('createName').value.trim();
-            if (!name) {
-                showNotification('Nom requis', 'error');
-                return;
-            }
-
+        async function purgeTrash(id) {
+            const message = id ? 'Supprimer définitivement cet élément ?' : 'Vider la corbeille ? Cette action est irréversible.';
+            if (!confirm(message)) return;
+            
             try {
-                const res = await fetch('/api/create', {
+                const res = await fetch('/api/trash/purge', {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify({
-                        type: createType,
-                        name: name
-                    })
+                    body: JSON.stringify({ id: id })
                 });
                 const result = await res.json();
                 
                 if (result.success) {
-                    hideCreateModal();
-                    showNotification('Créé avec succès', 'success');
-                    loadTree();
+                    showNotification(result.message, 'success');
+                    loadTrash();
                 } else {
                     showNotification(result.message, 'error');
                 }
@@ -1028,55 +4870,74 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             }
         }
 
-        // MENU CONTEXTUEL
-        function showContextMenu(e, path, isDir) {
-            const existing = document.querySelector('.context-menu');
-            if (existing) existing.remove();
-            
-            const menu = document.createElement('div');
-            menu.className = 'context-menu';
-            menu.style.left = e.pageX + 'px';
-            menu.style.top = e.pageY + 'px';
-            
-            const item = document.createElement('div');
-            item.className = 'context-menu-item';
-            item.innerHTML = '<span>×</span> Supprimer';
-            item.onclick = function() { deleteItem(path); };
-            menu.appendChild(item);
-            
-            document.body.appendChild(menu);
-            contextMenuTarget = path;
-            
-            setTimeout(() => {
-                document.addEventListener('click', closeContextMenu);
-            }, 10);
+        // PERMISSIONS
+        async function showPermModal(path) {
+            try {
+                const res = await fetch('/api/permissions?path=' + encodeURIComponent(path));
+                const result = await res.json();
+                
+                if (!result.success) {
+                    showNotification(result.message, 'error');
+                    return;
+                }
+                
+                permTarget = result.data;
+                document.getElementById('permPath').textContent = path;
+                document.getElementById('permMode').value = result.data.mode;
+                document.getElementById('permOwner').value = result.data.owner || result.data.uid;
+                document.getElementById('permGroup').value = result.data.group || result.data.gid;
+                document.getElementById('permRecursive').checked = false;
+                document.getElementById('permRecursiveGroup').style.display = result.data.isDir ? '' : 'none';
+                syncPermGrid();
+                document.getElementById('permModal').classList.remove('hidden');
+            } catch (e) {
+                showNotification('Erreur: ' + e.message, 'error');
+            }
+        }
+
+        function hidePermModal() {
+            document.getElementById('permModal').classList.add('hidden');
         }
 
-        function closeContextMenu() {
-            const menu = document.querySelector('.context-menu');
-            if (menu) menu.remove();
-            document.removeEventListener('click', closeContextMenu);
+        function syncPermGrid() {
+            const mode = parseInt(document.getElementById('permMode').value, 8) || 0;
+            document.querySelectorAll('#permGrid input').forEach(box => {
+                box.checked = (mode & parseInt(box.dataset.bit)) !== 0;
+            });
+        }
+
+        function syncPermMode() {
+            let mode = (parseInt(document.getElementById('permMode').value, 8) || 0) & 0o7000;
+            document.querySelectorAll('#permGrid input').forEach(box => {
+                if (box.checked) mode |= parseInt(box.dataset.bit);
+            });
+            document.getElementById('permMode').value = mode.toString(8).padStart(4, '0');
         }
 
-        async function deleteItem(path) {
-            if (!confirm('Supprimer ' + path + ' ?')) return;
+        async function applyPermissions() {
+            if (!permTarget) return;
+            
+            const owner = document.getElementById('permOwner').value.trim();
+            const group = document.getElementById('permGroup').value.trim();
+            const data = {
+                path: permTarget.path,
+                mode: document.getElementById('permMode').value.trim(),
+                owner: owner === (permTarget.owner || String(permTarget.uid)) ? '' : owner,
+                group: group === (permTarget.group || String(permTarget.gid)) ? '' : group,
+                recursive: document.getElementById('permRecursive').checked
+            };
             
             try {
-                const res = await fetch('/api/delete', {
+                const res = await fetch('/api/permissions', {
                     method: 'POST',
                     headers: {'Content-Type': 'application/json'},
-                    body: JSON.stringify({ path: path })
+                    body: JSON.stringify(data)
                 });
                 const result = await res.json();
                 
                 if (result.success) {
-                    showNotification('Supprimé', 'success');
-                    if (currentFile === path) {
-                        currentFile = '';
-                        document.getElementById('editor').value = '';
-                        document.getElementById('saveBtn').disabled = true;
-                    }
-                    loadTree();
+                    hidePermModal();
+                    showNotification(result.message, 'success');
                 } else {
                     showNotification(result.message, 'error');
                 }
@@ -1087,21 +4948,38 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
 
         // UTILITAIRES
         function disconnect() {
+            stopWatching();
+            stopSearch();
+            closeAllTerminals();
+            stopTask();
             currentFile = '';
+            selectedFolder = '';
+            closeViewer();
+            hideMediaPreview();
             expandedFolders.clear();
             document.getElementById('editor').value = '';
+            document.getElementById('editor').readOnly = false;
+            baseContent = '';
             document.getElementById('tree').innerHTML = '';
             document.getElementById('current-file').textContent = 'Aucun fichier ouvert';
             document.getElementById('file-size').textContent = '';
             document.getElementById('connection-info').textContent = '';
             document.getElementById('language-info').textContent = '';
+            showFormat(null);
             document.getElementById('saveBtn').disabled = true;
+            document.getElementById('reviewBtn').disabled = true;
+            document.getElementById('historyBtn').disabled = true;
             updateStatus('Déconnecté');
         }
 
         function updateStatus(msg, loading = false) {
             const statusEl = document.getElementById('status-text');
-            statusEl.innerHTML = loading ? '<span class="loading"></span> ' + msg : msg;
+            statusEl.textContent = msg;
+            if (loading) {
+                const spinner = document.createElement('span');
+                spinner.className = 'loading';
+                statusEl.prepend(spinner, ' ');
+            }
         }
 
         function formatBytes(bytes) {
@@ -1165,6 +5043,53 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             // Removed
         }
 
+        // Flux d'événements envoyé en POST, avec la même interface
+        // qu'EventSource (addEventListener, onerror, close)
+        function postEventStream(url) {
+            const controller = new AbortController();
+            const listeners = {};
+            const stream = {
+                onerror: null,
+                addEventListener(type, fn) {
+                    (listeners[type] = listeners[type] || []).push(fn);
+                },
+                close() {
+                    controller.abort();
+                }
+            };
+
+            (async () => {
+                try {
+                    const res = await fetch(url, { method: 'POST', signal: controller.signal });
+                    if (!res.ok) throw new Error(res.statusText);
+                    const reader = res.body.getReader();
+                    const decoder = new TextDecoder();
+                    let buffer = '';
+                    while (true) {
+                        const { done, value } = await reader.read();
+                        if (done) break;
+                        buffer += decoder.decode(value, { stream: true });
+                        let end;
+                        while ((end = buffer.indexOf('\n\n')) >= 0) {
+                            const block = buffer.slice(0, end);
+                            buffer = buffer.slice(end + 2);
+                            let type = 'message';
+                            const data = [];
+                            block.split('\n').forEach(line => {
+                                if (line.startsWith('event: ')) type = line.slice(7);
+                                else if (line.startsWith('data: ')) data.push(line.slice(6));
+                            });
+                            (listeners[type] || []).forEach(fn => fn({ data: data.join('\n') }));
+                        }
+                    }
+                    if (!controller.signal.aborted && stream.onerror) stream.onerror();
+                } catch (e) {
+                    if (!controller.signal.aborted && stream.onerror) stream.onerror(e);
+                }
+            })();
+            return stream;
+        }
+
         function showNotification(message, type = 'success') {
             const notif = document.createElement('div');
             notif.className = 'notification ' + type;
@@ -1196,8 +5121,26 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
         }
 
         // ÉVÉNEMENTS
+        document.getElementById('uploadInput').addEventListener('change', onUploadInput);
+        document.getElementById('uploadFolderInput').addEventListener('change', onUploadInput);
+        
+        const treeContainer = document.getElementById('tree-container');
+        treeContainer.addEventListener('dragover', (e) => {
+            e.preventDefault();
+            treeContainer.classList.add('drop-target');
+        });
+        treeContainer.addEventListener('dragleave', () => treeContainer.classList.remove('drop-target'));
+        treeContainer.addEventListener('drop', (e) => {
+            e.preventDefault();
+            treeContainer.classList.remove('drop-target');
+            dropUpload(e, '');
+        });
+        
+        document.getElementById('permMode').addEventListener('input', syncPermGrid);
+        document.querySelectorAll('#permGrid input').forEach(box => box.addEventListener('change', syncPermMode));
+        
         document.getElementById('editor').addEventListener('input', function() {
-            // No highlighting
+            dirty = true;
         });
         
         document.getElementById('editor').addEventListener('keydown', (e) => {
@@ -1205,6 +5148,10 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
                 e.preventDefault();
                 saveFile();
             }
+            if (e.ctrlKey && e.shiftKey && e.key === 'S') {
+                e.preventDefault();
+                showReviewModal();
+            }
             if (e.key === 'Tab') {
                 e.preventDefault();
                 const start = e.target.selectionStart;
@@ -1218,6 +5165,43 @@ func handleIndex(w http.ResponseWriter, r *http.Request) {
             // No sync needed
         });
 
+        document.getElementById('quickOpenInput').addEventListener('input', () => {
+            clearTimeout(quickOpenTimer);
+            quickOpenTimer = setTimeout(queryQuickOpen, 80);
+        });
+        
+        document.getElementById('quickOpenInput').addEventListener('keydown', (e) => {
+            if (e.key === 'ArrowDown' || e.key === 'ArrowUp') {
+                e.preventDefault();
+                const n = quickOpenResults.length;
+                if (n === 0) return;
+                quickOpenActive = (quickOpenActive + (e.key === 'ArrowDown' ? 1 : n - 1)) % n;
+                renderQuickOpen();
+            } else if (e.key === 'Enter') {
+                e.preventDefault();
+                openQuickResult(quickOpenActive);
+            } else if (e.key === 'Escape') {
+                hideQuickOpen();
+            }
+        });
+        
+        document.getElementById('searchQuery').addEventListener('keydown', (e) => {
+            if (e.key === 'Enter') startSearch();
+        });
+        
+        document.addEventListener('keydown', (e) => {
+            if (e.ctrlKey && e.shiftKey && (e.key === 'F' || e.key === 'f')) {
+                e.preventDefault();
+                showSearchModal();
+            } else if (e.ctrlKey && !e.shiftKey && (e.key === 'p' || e.key === 'P')) {
+                e.preventDefault();
+                showQuickOpen();
+            } else if (e.ctrlKey && !e.shiftKey && (e.key === 'j' || e.key === 'J')) {
+                e.preventDefault();
+                toggleTerminalPanel();
+            }
+        });
+
         window.onload = () => showConnectModal();
     </script>
 </body>
@@ -1233,6 +5217,37 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	addr := fmt.Sprintf("%s:%s", req.Host, req.Port)
+	client, sftpClient, err := dialRemote(req)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	server.sshClient = client
+	server.sftpClient = sftpClient
+	server.rootPath = req.Path
+	server.host = fmt.Sprintf("%s@%s", req.Username, addr)
+	server.useSudo = req.UseSudo
+	server.password = req.Password
+
+	if server.watcher != nil {
+		server.watcher.Close()
+	}
+	server.watcher = newWatcher()
+	go server.watcher.run()
+	server.index = newFileIndex()
+	go server.index.follow(server.watcher)
+	resetLineIndexes()
+	if server.terminals != nil {
+		server.terminals.Close()
+	}
+	server.terminals = newTerminalSet()
+
+	sendSuccess(w, "Connecté avec succès", nil)
+}
+
+func dialRemote(req ConnectRequest) (*ssh.Client, *sftp.Client, error) {
 	config := &ssh.ClientConfig{
 		User: req.Username,
 		Auth: []ssh.AuthMethod{
@@ -1244,24 +5259,15 @@ func handleConnect(w http.ResponseWriter, r *http.Request) {
 	addr := fmt.Sprintf("%s:%s", req.Host, req.Port)
 	client, err := ssh.Dial("tcp", addr, config)
 	if err != nil {
-		sendError(w, fmt.Sprintf("Connexion SSH échouée: %v", err))
-		return
+		return nil, nil, fmt.Errorf("Connexion SSH échouée: %v", err)
 	}
 
 	sftpClient, err := sftp.NewClient(client)
 	if err != nil {
 		client.Close()
-		sendError(w, fmt.Sprintf("Connexion SFTP échouée: %v", err))
-		return
+		return nil, nil, fmt.Errorf("Connexion SFTP échouée: %v", err)
 	}
-
-	server.sshClient = client
-	server.sftpClient = sftpClient
-	server.rootPath = req.Path
-	server.useSudo = req.UseSudo
-	server.password = req.Password
-
-	sendSuccess(w, "Connecté avec succès", nil)
+	return client, sftpClient, nil
 }
 
 func handleTree(w http.ResponseWriter, r *http.Request) {
@@ -1275,6 +5281,9 @@ func handleTree(w http.ResponseWriter, r *http.Request) {
 		sendError(w, fmt.Sprintf("Erreur: %v", err))
 		return
 	}
+	if server.index != nil {
+		server.index.replace(tree)
+	}
 
 	sendSuccess(w, "", tree)
 }
@@ -1347,34 +5356,78 @@ func handleFile(w http.ResponseWriter, r *http.Request) {
 
 	path = filepath.ToSlash(path)
 
-	var content []byte
-	var err error
-
-	if server.useSudo {
-		content, err = readFileWithSudo(path)
-	} else {
-		file, err2 := server.sftpClient.Open(path)
-		if err2 != nil {
-			sendError(w, fmt.Sprintf("Impossible d'ouvrir: %v", err2))
-			return
+	if size, tooLarge := isTooLargeToEdit(path); tooLarge {
+		reason := "large"
+		if sample, err := readRange(path, 0, binarySampleSize); err == nil && isBinary(sample) {
+			reason = "binary"
 		}
-		defer file.Close()
-		content, err = io.ReadAll(file)
+		sendSuccess(w, "", map[string]interface{}{
+			"content":  "",
+			"size":     size,
+			"readOnly": true,
+			"reason":   reason,
+			"limit":    maxEditSize,
+		})
+		return
 	}
 
+	content, err := readRemoteFile(path)
 	if err != nil {
 		sendError(w, fmt.Sprintf("Erreur de lecture: %v", err))
 		return
 	}
 
+	if isBinary(content) {
+		sendSuccess(w, "", map[string]interface{}{
+			"content":  "",
+			"size":     len(content),
+			"readOnly": true,
+			"reason":   "binary",
+		})
+		return
+	}
+
+	text, format := decodeText(content)
 	data := map[string]interface{}{
-		"content": string(content),
+		"content": text,
 		"size":    len(content),
+		"version": contentVersion(content),
+		"format":  format,
 	}
 
 	sendSuccess(w, "", data)
 }
 
+func readRemoteFile(path string) ([]byte, error) {
+	if server.useSudo {
+		return readFileWithSudo(path)
+	}
+
+	file, err := server.sftpClient.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("impossible d'ouvrir: %w", err)
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func remoteExists(path string) bool {
+	if _, err := server.sftpClient.Lstat(path); err == nil {
+		return true
+	} else if !server.useSudo || os.IsNotExist(err) {
+		return false
+	}
+
+	_, err := runRemoteCommand("test -e " + shellQuote(path))
+	return err == nil
+}
+
+func contentVersion(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16])
+}
+
 func handleSave(w http.ResponseWriter, r *http.Request) {
 	if server.sftpClient == nil {
 		sendError(w, "Non connecté")
@@ -1382,8 +5435,10 @@ func handleSave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path    string      `json:"path"`
+		Content string      `json:"content"`
+		Version string      `json:"version"`
+		Format  *TextFormat `json:"format"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1393,25 +5448,64 @@ func handleSave(w http.ResponseWriter, r *http.Request) {
 
 	req.Path = filepath.ToSlash(req.Path)
 
-	var err error
-	if server.useSudo {
-		err = writeFileWithSudo(req.Path, req.Content)
-	} else {
-		file, err2 := server.sftpClient.Create(req.Path)
-		if err2 != nil {
-			sendError(w, fmt.Sprintf("Impossible de créer: %v", err2))
+	if req.Version == "" {
+		sendError(w, "Version du fichier requise, rechargez-le avant de sauvegarder")
+		return
+	}
+
+	currentVersion := missingVersion
+	var current []byte
+	if remoteExists(req.Path) {
+		if _, tooLarge := isTooLargeToEdit(req.Path); tooLarge {
+			sendError(w, "Le fichier distant dépasse la taille éditable")
+			return
+		}
+		var err error
+		current, err = readRemoteFile(req.Path)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur de lecture: %v", err))
+			return
+		}
+		if isBinary(current) {
+			sendError(w, "Fichier binaire : l'édition en mode texte est refusée")
 			return
 		}
-		defer file.Close()
-		_, err = io.WriteString(file, req.Content)
+		currentVersion = contentVersion(current)
+	}
+
+	if req.Version != currentVersion {
+		remoteText, remoteFormat := decodeText(current)
+		sendConflict(w, "Le fichier a été modifié sur le serveur depuis son ouverture", map[string]interface{}{
+			"conflict": true,
+			"content":  remoteText,
+			"format":   remoteFormat,
+			"version":  currentVersion,
+			"deleted":  currentVersion == missingVersion,
+		})
+		return
 	}
 
+	format := TextFormat{Encoding: "utf-8", EOL: "lf"}
+	if req.Format != nil {
+		format = *req.Format
+	}
+	encoded, err := encodeText(req.Content, format)
 	if err != nil {
+		sendError(w, fmt.Sprintf("Conversion impossible: %v", err))
+		return
+	}
+
+	if err := writeRemoteFile(req.Path, encoded); err != nil {
 		sendError(w, fmt.Sprintf("Erreur d'écriture: %v", err))
 		return
 	}
 
-	sendSuccess(w, "Fichier sauvegardé", nil)
+	recordSave(req.Path, current, encoded, webUser(r))
+
+	sendSuccess(w, "Fichier sauvegardé", map[string]interface{}{
+		"version": contentVersion(encoded),
+		"size":    len(encoded),
+	})
 }
 
 func handleCreate(w http.ResponseWriter, r *http.Request) {
@@ -1421,8 +5515,10 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Type string `json:"type"`
-		Name string `json:"name"`
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Parent string `json:"parent"`
+		Mode   string `json:"mode"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1430,38 +5526,85 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newPath := filepath.ToSlash(filepath.Join(server.rootPath, req.Name))
+	name := strings.Trim(filepath.ToSlash(req.Name), "/")
+	if name == "" {
+		sendError(w, "Nom requis")
+		return
+	}
+
+	parent := cleanRemotePath(req.Parent)
+	if parent == "" {
+		parent = defaultParent()
+	}
+
+	newPath := path.Join(parent, name)
+	if !strings.HasPrefix(newPath, strings.TrimSuffix(parent, "/")+"/") {
+		sendError(w, "Le nom doit rester dans le dossier parent")
+		return
+	}
+
+	if _, err := server.sftpClient.Lstat(newPath); err == nil {
+		sendError(w, fmt.Sprintf("%s existe déjà", newPath))
+		return
+	}
 
-	if req.Type == "folder" {
+	var mode os.FileMode
+	if req.Mode != "" {
 		var err error
-		if server.useSudo {
-			err = createFolderWithSudo(newPath)
-		} else {
-			err = server.sftpClient.Mkdir(newPath)
-		}
+		mode, err = parseMode(req.Mode)
 		if err != nil {
-			sendError(w, fmt.Sprintf("Erreur: %v", err))
+			sendError(w, fmt.Sprintf("Mode invalide: %s", req.Mode))
 			return
 		}
-	} else {
-		var err error
-		if server.useSudo {
-			err = writeFileWithSudo(newPath, "")
-		} else {
-			file, err2 := server.sftpClient.Create(newPath)
-			if err2 != nil {
-				sendError(w, fmt.Sprintf("Erreur: %v", err2))
-				return
-			}
-			file.Close()
-		}
-		if err != nil {
-			sendError(w, fmt.Sprintf("Erreur: %v", err))
-			return
+	}
+
+	var err error
+	if server.useSudo {
+		err = createWithSudo(newPath, req.Type == "folder", req.Mode)
+	} else if req.Type == "folder" {
+		err = server.sftpClient.MkdirAll(newPath)
+		if err == nil && req.Mode != "" {
+			err = server.sftpClient.Chmod(newPath, mode)
 		}
+	} else {
+		err = createFileWithSFTP(newPath, req.Mode != "", mode)
+	}
+
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	sendSuccess(w, "Créé avec succès", map[string]interface{}{
+		"path": newPath,
+	})
+}
+
+func defaultParent() string {
+	info, err := server.sftpClient.Stat(server.rootPath)
+	if err == nil && !info.IsDir() {
+		return path.Dir(cleanRemotePath(server.rootPath))
+	}
+	return cleanRemotePath(server.rootPath)
+}
+
+func createFileWithSFTP(p string, setMode bool, mode os.FileMode) error {
+	if err := server.sftpClient.MkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+
+	file, err := server.sftpClient.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
 	}
 
-	sendSuccess(w, "Créé avec succès", nil)
+	if setMode {
+		return server.sftpClient.Chmod(p, mode)
+	}
+	return nil
 }
 
 func handleDelete(w http.ResponseWriter, r *http.Request) {
@@ -1471,7 +5614,8 @@ func handleDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Path string `json:"path"`
+		Path      string `json:"path"`
+		Permanent bool   `json:"permanent"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -1479,25 +5623,28 @@ func handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Path = filepath.ToSlash(req.Path)
+	req.Path = cleanRemotePath(req.Path)
+	if req.Path == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
 
-	var err error
-	if server.useSudo {
-		err = deleteWithSudo(req.Path)
-	} else {
-		info, err2 := server.sftpClient.Stat(req.Path)
-		if err2 != nil {
-			sendError(w, fmt.Sprintf("Erreur: %v", err2))
+	if isProtectedPath(req.Path) {
+		sendError(w, fmt.Sprintf("%s est protégé et ne peut pas être supprimé", req.Path))
+		return
+	}
+
+	if !req.Permanent && !isInTrash(req.Path) {
+		item, err := moveToTrash(req.Path)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur: %v", err))
 			return
 		}
-		if info.IsDir() {
-			err = server.sftpClient.RemoveDirectory(req.Path)
-		} else {
-			err = server.sftpClient.Remove(req.Path)
-		}
+		sendSuccess(w, "Déplacé dans la corbeille", item)
+		return
 	}
 
-	if err != nil {
+	if err := removeRemote(req.Path); err != nil {
 		sendError(w, fmt.Sprintf("Erreur: %v", err))
 		return
 	}
@@ -1523,69 +5670,195 @@ func sendError(w http.ResponseWriter, message string) {
 	})
 }
 
+// checkSameOrigin rejects requests whose Origin header names another site.
+func checkSameOrigin(r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return fmt.Errorf("origine refusée: %s", origin)
+		}
+	}
+	return nil
+}
+
+// checkCommandRequest guards the endpoints that run commands on the server.
+// They only accept POST, which browsers always send with an Origin header,
+// so that another page cannot trigger them with a link or an image.
+func checkCommandRequest(r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return errors.New("méthode POST requise")
+	}
+	return checkSameOrigin(r)
+}
+
+func sendConflict(w http.ResponseWriter, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(Response{
+		Success: false,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// readFileWithSudo reads the file from stdout only, so sudo's prompt and
+// warnings on stderr can never end up in the content.
 func readFileWithSudo(path string) ([]byte, error) {
+	var content bytes.Buffer
+	if err := streamRemoteCommand("cat -- "+shellQuote(path), &content); err != nil {
+		return nil, err
+	}
+	return content.Bytes(), nil
+}
+
+func writeFileWithSudo(path, content string) error {
+	return writeStagedWithSudo(path, strings.NewReader(content))
+}
+
+func createWithSudo(p string, isDir bool, mode string) error {
+	cmd := fmt.Sprintf("test ! -e %[1]s || { echo %[1]s existe déjà >&2; exit 1; }; ", shellQuote(p))
+	if isDir {
+		cmd += fmt.Sprintf("mkdir -p -- %s", shellQuote(p))
+	} else {
+		cmd += fmt.Sprintf("mkdir -p -- %s && : > %s", shellQuote(path.Dir(p)), shellQuote(p))
+	}
+	if mode != "" {
+		cmd += fmt.Sprintf(" && chmod %s -- %s", mode, shellQuote(p))
+	}
+
+	output, err := runRemoteCommand(cmd)
+	if err != nil {
+		return commandError(output, err)
+	}
+	return nil
+}
+
+func deleteWithSudo(path string) error {
+	output, err := runRemoteCommand("rm -rf -- " + shellQuote(path))
+	if err != nil {
+		return commandError(output, err)
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func sudoCommand(cmd string) string {
+	return fmt.Sprintf("echo %s | sudo -S -p '' sh -c %s", shellQuote(server.password), shellQuote(cmd))
+}
+
+func runRemoteCommand(cmd string) ([]byte, error) {
 	session, err := server.sshClient.NewSession()
 	if err != nil {
 		return nil, err
 	}
 	defer session.Close()
 
-	cmd := fmt.Sprintf("echo '%s' | sudo -S cat '%s'", server.password, path)
-	output, err := session.CombinedOutput(cmd)
+	if server.useSudo {
+		cmd = sudoCommand(cmd)
+	}
+	return session.CombinedOutput(cmd)
+}
+
+func streamRemoteCommand(cmd string, stdout io.Writer) error {
+	session, err := server.sshClient.NewSession()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer session.Close()
 
-	lines := strings.Split(string(output), "\n")
-	if len(lines) > 0 && strings.Contains(lines[0], "sudo") {
-		return []byte(strings.Join(lines[1:], "\n")), nil
+	if server.useSudo {
+		cmd = sudoCommand(cmd)
 	}
 
-	return output, nil
+	var stderr strings.Builder
+	session.Stdout = stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		return commandError([]byte(stderr.String()), err)
+	}
+	return nil
 }
 
-func writeFileWithSudo(path, content string) error {
+// streamRemoteLines runs cmd and calls onLine for each line of its output,
+// until onLine returns false, the command exits or ctx is cancelled.
+func streamRemoteLines(ctx context.Context, cmd string, onLine func(string) bool) error {
 	session, err := server.sshClient.NewSession()
 	if err != nil {
 		return err
 	}
+	// Closing the session makes the remote command exit on SIGPIPE.
 	defer session.Close()
 
-	cmd := fmt.Sprintf("echo '%s' | sudo -S tee '%s' > /dev/null", server.password, path)
+	if server.useSudo {
+		cmd = sudoCommand(cmd)
+	}
 
-	stdin, err := session.StdinPipe()
+	stdout, err := session.StdoutPipe()
 	if err != nil {
 		return err
 	}
-
+	var stderr strings.Builder
+	session.Stderr = &stderr
 	if err := session.Start(cmd); err != nil {
 		return err
 	}
 
-	io.WriteString(stdin, content)
-	stdin.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, readErr := reader.ReadString('\n')
+		if line != "" && !onLine(strings.TrimSuffix(line, "\n")) {
+			return nil
+		}
+		if readErr != nil {
+			break
+		}
+	}
 
-	return session.Wait()
+	err = session.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return commandError([]byte(stderr.String()), err)
+	}
+	return nil
 }
 
-func createFolderWithSudo(path string) error {
+func remoteCommandExists(name string) bool {
 	session, err := server.sshClient.NewSession()
 	if err != nil {
-		return err
+		return false
 	}
 	defer session.Close()
 
-	cmd := fmt.Sprintf("echo '%s' | sudo -S mkdir -p '%s'", server.password, path)
-	return session.Run(cmd)
+	return session.Run("command -v "+shellQuote(name)+" >/dev/null 2>&1") == nil
 }
 
-func deleteWithSudo(path string) error {
-	session, err := server.sshClient.NewSession()
-	if err != nil {
-		return err
+func isCommandUnavailable(err error) bool {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus() == 127
 	}
-	defer session.Close()
+	return err != nil
+}
 
-	cmd := fmt.Sprintf("echo '%s' | sudo -S rm -rf '%s'", server.password, path)
-	return session.Run(cmd)
-}
\ No newline at end of file
+func commandError(output []byte, err error) error {
+	msg := strings.TrimSpace(string(output))
+	if msg == "" {
+		return err
+	}
+	return fmt.Errorf("%w: %s", err, msg)
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// syncRoot is the local folder sync may read and write. Sync stays disabled
+// until it is set with -sync-root, since the server has no authentication.
+var syncRoot string
+
+type syncEntry struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+type SyncAction struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+}
+
+type syncRequest struct {
+	Local   string   `json:"local"`
+	Remote  string   `json:"remote"`
+	Mode    string   `json:"mode"`
+	Compare string   `json:"compare"`
+	Ignore  []string `json:"ignore"`
+	DryRun  bool     `json:"dryRun"`
+}
+
+// resolveLocalPath checks that a local path stays inside the -sync-root
+// directory, since sync reads and writes on the machine running ssh-editor.
+func resolveLocalPath(p string) (string, error) {
+	if syncRoot == "" {
+		return "", fmt.Errorf("synchronisation locale désactivée (-sync-root)")
+	}
+	root, err := filepath.Abs(syncRoot)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(root, p)
+	}
+	p = filepath.Clean(p)
+
+	p = resolveExistingPrefix(p)
+	if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolvedRoot
+	}
+	if rel, err := filepath.Rel(root, p); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s est en dehors du dossier autorisé %s", p, root)
+	}
+	return p, nil
+}
+
+// resolveExistingPrefix resolves symlinks in the longest existing prefix of
+// p, so that a path still to be created cannot escape through a link.
+func resolveExistingPrefix(p string) string {
+	rest := ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(p, rest)
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+func walkLocal(root string, ignore []string) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if matchesIgnore(ignore, d.Name(), rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		entries[rel] = syncEntry{size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir()}
+		return nil
+	})
+	return entries, err
+}
+
+func walkRemote(root string, ignore []string) (map[string]syncEntry, error) {
+	entries := map[string]syncEntry{}
+	walker := server.sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			if walker.Path() == root {
+				return nil, err
+			}
+			continue
+		}
+		p := walker.Path()
+		if p == root {
+			continue
+		}
+		info := walker.Stat()
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		if matchesIgnore(ignore, info.Name(), rel) {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+		entries[rel] = syncEntry{size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir()}
+	}
+	return entries, nil
+}
+
+func hashLocalFile(p string) (string, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashRemoteFile(p string) (string, error) {
+	file, err := server.sftpClient.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// differs tells why a file must be transferred, or "" when it is up to
+// date. Modification times are compared to the second, as SFTP reports them.
+func (req *syncRequest) differs(rel string, src, dst syncEntry) string {
+	if src.size != dst.size {
+		return "taille"
+	}
+	switch req.Compare {
+	case "size":
+		return ""
+	case "checksum":
+		localHash, err := hashLocalFile(filepath.Join(req.Local, filepath.FromSlash(rel)))
+		if err != nil {
+			return "erreur: " + err.Error()
+		}
+		remoteHash, err := hashRemoteFile(path.Join(req.Remote, rel))
+		if err != nil {
+			return "erreur: " + err.Error()
+		}
+		if localHash != remoteHash {
+			return "contenu"
+		}
+		return ""
+	default:
+		if src.modTime.Unix() != dst.modTime.Unix() {
+			return "date"
+		}
+		return ""
+	}
+}
+
+// plan lists the actions that bring the destination in line with the
+// source: folders to create, files to copy and, in mirror mode, entries to
+// delete (only the top-most of a deleted tree is listed).
+func (req *syncRequest) plan(local, remote map[string]syncEntry) []SyncAction {
+	src, dst := local, remote
+	copyAction := "upload"
+	if req.Mode == "pull" {
+		src, dst = remote, local
+		copyAction = "download"
+	}
+
+	var names []string
+	for rel := range src {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+
+	var actions []SyncAction
+	for _, rel := range names {
+		s := src[rel]
+		d, exists := dst[rel]
+		switch {
+		case s.isDir && !exists:
+			actions = append(actions, SyncAction{Path: rel, Action: "mkdir"})
+		case s.isDir && !d.isDir, !s.isDir && exists && d.isDir:
+			actions = append(actions, SyncAction{Path: rel, Action: "skip", Reason: "type différent"})
+		case s.isDir:
+		case !exists:
+			actions = append(actions, SyncAction{Path: rel, Action: copyAction, Reason: "nouveau", Size: s.size})
+		default:
+			if reason := req.differs(rel, s, d); reason != "" {
+				actions = append(actions, SyncAction{Path: rel, Action: copyAction, Reason: reason, Size: s.size})
+			}
+		}
+	}
+
+	if req.Mode == "mirror" {
+		var extra []string
+		for rel := range dst {
+			if _, ok := src[rel]; !ok {
+				extra = append(extra, rel)
+			}
+		}
+		sort.Strings(extra)
+		deleted := map[string]bool{}
+		for _, rel := range extra {
+			covered := false
+			for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+				if deleted[dir] {
+					covered = true
+					break
+				}
+			}
+			if covered {
+				continue
+			}
+			deleted[rel] = true
+			actions = append(actions, SyncAction{Path: rel, Action: "delete", Size: dst[rel].size})
+		}
+	}
+	return actions
+}
+
+func setRemoteModTime(p string, modTime time.Time) error {
+	if server.useSudo {
+		output, err := runRemoteCommand(fmt.Sprintf("touch -m -d @%d -- %s", modTime.Unix(), shellQuote(p)))
+		if err != nil {
+			return commandError(output, err)
+		}
+		return nil
+	}
+	return server.sftpClient.Chtimes(p, modTime, modTime)
+}
+
+func mkdirRemote(p string) error {
+	if server.useSudo {
+		output, err := runRemoteCommand("mkdir -p -- " + shellQuote(p))
+		if err != nil {
+			return commandError(output, err)
+		}
+		return nil
+	}
+	return server.sftpClient.MkdirAll(p)
+}
+
+func (req *syncRequest) upload(rel string) error {
+	localPath := filepath.Join(req.Local, filepath.FromSlash(rel))
+	remotePath := path.Join(req.Remote, rel)
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if server.useSudo {
+		_, err = writeStreamWithSudo(remotePath, file)
+	} else {
+		_, err = writeStreamWithSFTP(remotePath, file)
+	}
+	if err != nil {
+		return err
+	}
+	return setRemoteModTime(remotePath, info.ModTime())
+}
+
+func (req *syncRequest) download(rel string) error {
+	localPath := filepath.Join(req.Local, filepath.FromSlash(rel))
+	remotePath := path.Join(req.Remote, rel)
+
+	src, err := server.sftpClient.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".ssh-editor-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Chmod(tmp.Name(), info.Mode().Perm())
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Chtimes(localPath, info.ModTime(), info.ModTime())
+}
+
+func (req *syncRequest) apply(action SyncAction) error {
+	switch action.Action {
+	case "upload":
+		return req.upload(action.Path)
+	case "download":
+		return req.download(action.Path)
+	case "mkdir":
+		if req.Mode == "pull" {
+			return os.MkdirAll(filepath.Join(req.Local, filepath.FromSlash(action.Path)), 0755)
+		}
+		return mkdirRemote(path.Join(req.Remote, action.Path))
+	case "delete":
+		target := path.Join(req.Remote, action.Path)
+		if isProtectedPath(target) {
+			return fmt.Errorf("chemin protégé")
+		}
+		if isInTrash(target) {
+			return removeRemote(target)
+		}
+		_, err := moveToTrash(target)
+		return err
+	}
+	return nil
+}
+
+func handleSync(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	switch req.Mode {
+	case "push", "pull", "mirror":
+	default:
+		sendError(w, "Mode invalide (push, pull ou mirror)")
+		return
+	}
+	switch req.Compare {
+	case "", "mtime", "size", "checksum":
+	default:
+		sendError(w, "Comparaison invalide (mtime, size ou checksum)")
+		return
+	}
+	if req.Ignore == nil {
+		req.Ignore = defaultSearchIgnores
+	}
+
+	local, err := resolveLocalPath(req.Local)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Dossier local: %v", err))
+		return
+	}
+	req.Local = local
+	req.Remote = cleanRemotePath(req.Remote)
+	if req.Remote == "" {
+		req.Remote = defaultParent()
+	}
+
+	localMissing := false
+	if req.Mode == "pull" {
+		if req.DryRun {
+			_, err := os.Stat(req.Local)
+			localMissing = os.IsNotExist(err)
+		} else if err := os.MkdirAll(req.Local, 0755); err != nil {
+			sendError(w, fmt.Sprintf("Dossier local: %v", err))
+			return
+		}
+	} else if info, err := os.Stat(req.Local); err != nil || !info.IsDir() {
+		sendError(w, fmt.Sprintf("Dossier local introuvable: %s", req.Local))
+		return
+	}
+	if req.Mode != "pull" && !req.DryRun && !remoteExists(req.Remote) {
+		if err := mkdirRemote(req.Remote); err != nil {
+			sendError(w, fmt.Sprintf("Dossier distant: %v", err))
+			return
+		}
+	}
+
+	localEntries := map[string]syncEntry{}
+	if !localMissing {
+		localEntries, err = walkLocal(req.Local, req.Ignore)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Lecture du dossier local: %v", err))
+			return
+		}
+	}
+	remoteEntries := map[string]syncEntry{}
+	if remoteExists(req.Remote) {
+		remoteEntries, err = walkRemote(req.Remote, req.Ignore)
+		if err != nil {
+			sendError(w, fmt.Sprintf("Lecture du dossier distant: %v", err))
+			return
+		}
+	}
+
+	actions := req.plan(localEntries, remoteEntries)
+	if actions == nil {
+		actions = []SyncAction{}
+	}
+
+	failed := 0
+	var transferred int64
+	if !req.DryRun {
+		for i := range actions {
+			if err := req.apply(actions[i]); err != nil {
+				actions[i].Error = err.Error()
+				failed++
+			} else if actions[i].Action == "upload" || actions[i].Action == "download" {
+				transferred += actions[i].Size
+			}
+		}
+	}
+
+	message := fmt.Sprintf("%d action(s)", len(actions))
+	if !req.DryRun {
+		message = fmt.Sprintf("Synchronisation terminée: %d action(s), %d en échec", len(actions), failed)
+	}
+	sendSuccess(w, message, map[string]interface{}{
+		"local":       req.Local,
+		"remote":      req.Remote,
+		"dryRun":      req.DryRun,
+		"actions":     actions,
+		"failed":      failed,
+		"transferred": transferred,
+	})
+}
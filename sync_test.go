@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveLocalPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "inside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := syncRoot
+	syncRoot = root
+	defer func() { syncRoot = saved }()
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"inside", true},
+		{"inside/new/dir", true},
+		{"new", true},
+		{filepath.Join(root, "inside"), true},
+		{"../elsewhere", false},
+		{outside, false},
+		{"escape", false},
+		{"escape/new/dir", false},
+	}
+
+	for _, tt := range tests {
+		if _, err := resolveLocalPath(tt.path); (err == nil) != tt.ok {
+			t.Errorf("resolveLocalPath(%q) error = %v, want ok %v", tt.path, err, tt.ok)
+		}
+	}
+
+	syncRoot = ""
+	if _, err := resolveLocalPath("inside"); err == nil {
+		t.Error("resolveLocalPath succeeded with sync disabled")
+	}
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var tasksDir = defaultTasksDir()
+
+const (
+	projectConfigName = ".ssh-editor.json"
+	maxTaskOutput     = 1 << 20
+	maxTaskRuns       = 50
+	taskKillGrace     = 3 * time.Second
+)
+
+// Task is a named command run from the editor. Project tasks come from
+// .ssh-editor.json next to the project root, connection tasks are kept on
+// the ssh-editor side for each user@host.
+type Task struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	Dir     string `json:"dir,omitempty"`
+	Sudo    bool   `json:"sudo,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+type projectConfig struct {
+	Tasks []Task `json:"tasks"`
+}
+
+type TaskRun struct {
+	ID        string     `json:"id"`
+	Host      string     `json:"host"`
+	Name      string     `json:"name"`
+	Source    string     `json:"source"`
+	Command   string     `json:"command"`
+	Dir       string     `json:"dir"`
+	User      string     `json:"user"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	Code      *int       `json:"code,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Cancelled bool       `json:"cancelled,omitempty"`
+	Truncated bool       `json:"truncated,omitempty"`
+}
+
+type TaskOutput struct {
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
+
+func defaultTasksDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ssh-editor-tasks")
+	}
+	return filepath.Join(home, ".ssh-editor", "tasks")
+}
+
+func tasksKeyDir(host string) string {
+	sum := sha256.Sum256([]byte(host))
+	return filepath.Join(tasksDir, hex.EncodeToString(sum[:12]))
+}
+
+func loadConnectionTasks() ([]Task, error) {
+	data, err := os.ReadFile(filepath.Join(tasksKeyDir(server.host), "tasks.json"))
+	if os.IsNotExist(err) {
+		return []Task{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tasks []Task
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		tasks[i].Source = "connection"
+	}
+	return tasks, nil
+}
+
+func saveConnectionTasks(tasks []Task) error {
+	dir := tasksKeyDir(server.host)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for i := range tasks {
+		tasks[i].Source = ""
+	}
+	data, err := json.MarshalIndent(tasks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "tasks.json"), data, 0600)
+}
+
+func projectConfigPath() string {
+	return path.Join(defaultParent(), projectConfigName)
+}
+
+// loadProjectTasks reads the tasks of .ssh-editor.json, if the project has one.
+func loadProjectTasks() ([]Task, error) {
+	p := projectConfigPath()
+	if !remoteExists(p) {
+		return []Task{}, nil
+	}
+	content, err := readRemoteFile(p)
+	if err != nil {
+		return []Task{}, err
+	}
+	var config projectConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return []Task{}, fmt.Errorf("%s invalide: %v", projectConfigName, err)
+	}
+	if err := validateTasks(config.Tasks); err != nil {
+		return []Task{}, fmt.Errorf("%s invalide: %v", projectConfigName, err)
+	}
+	for i := range config.Tasks {
+		config.Tasks[i].Source = "project"
+	}
+	return config.Tasks, nil
+}
+
+func validateTasks(tasks []Task) error {
+	names := map[string]bool{}
+	for _, task := range tasks {
+		if strings.TrimSpace(task.Name) == "" {
+			return fmt.Errorf("nom de tâche requis")
+		}
+		if strings.TrimSpace(task.Command) == "" {
+			return fmt.Errorf("commande requise pour %s", task.Name)
+		}
+		if names[task.Name] {
+			return fmt.Errorf("tâche %s définie deux fois", task.Name)
+		}
+		names[task.Name] = true
+	}
+	return nil
+}
+
+func findTask(source, name string) (Task, error) {
+	var tasks []Task
+	var err error
+	if source == "project" {
+		tasks, err = loadProjectTasks()
+	} else {
+		tasks, err = loadConnectionTasks()
+	}
+	if err != nil {
+		return Task{}, err
+	}
+	for _, task := range tasks {
+		if task.Name == name {
+			return task, nil
+		}
+	}
+	return Task{}, fmt.Errorf("tâche introuvable: %s", name)
+}
+
+// taskDir resolves the working directory of a task, relative to the project
+// folder unless absolute.
+func taskDir(task Task) string {
+	if task.Dir == "" {
+		return defaultParent()
+	}
+	if path.IsAbs(task.Dir) {
+		return cleanRemotePath(task.Dir)
+	}
+	return path.Join(defaultParent(), task.Dir)
+}
+
+func validTaskRunID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\.`)
+}
+
+func taskRunPaths(id string) (string, string) {
+	dir := filepath.Join(tasksKeyDir(server.host), "runs")
+	return filepath.Join(dir, id+".json"), filepath.Join(dir, id+".log")
+}
+
+func saveTaskRun(run *TaskRun) error {
+	meta, _ := taskRunPaths(run.ID)
+	if err := os.MkdirAll(filepath.Dir(meta), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(meta, data, 0600)
+}
+
+func listTaskRuns() ([]TaskRun, error) {
+	dir := filepath.Join(tasksKeyDir(server.host), "runs")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []TaskRun{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []TaskRun{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var run TaskRun
+		if json.Unmarshal(data, &run) == nil && run.Host == server.host {
+			runs = append(runs, run)
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID > runs[j].ID
+	})
+	return runs, nil
+}
+
+// pruneTaskRuns keeps the most recent maxTaskRuns runs of the connection.
+func pruneTaskRuns() {
+	runs, err := listTaskRuns()
+	if err != nil || len(runs) <= maxTaskRuns {
+		return
+	}
+	for _, run := range runs[maxTaskRuns:] {
+		meta, output := taskRunPaths(run.ID)
+		os.Remove(meta)
+		os.Remove(output)
+	}
+}
+
+// completeUTF8 returns the length of b without a trailing incomplete UTF-8
+// sequence, which is kept for the next chunk of output.
+func completeUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(b)
+}
+
+// taskShellCommand runs script with sh, whatever the login shell of the
+// SSH user, through sudo when asked.
+func taskShellCommand(script string, sudo bool) string {
+	if sudo {
+		return sudoCommand(script)
+	}
+	return "sh -c " + shellQuote(script)
+}
+
+// killTask terminates the process group of a running task. sshd starts each
+// command in its own session, so the group holds the task and its children.
+func killTask(pid int, sudo bool) error {
+	cmd := fmt.Sprintf("pgid=$(ps -o pgid= -p %d 2>/dev/null | tr -d ' '); "+
+		"if [ -n \"$pgid\" ] && [ \"$pgid\" -gt 1 ]; then kill -TERM -$pgid; else kill -TERM %d; fi", pid, pid)
+	session, err := server.sshClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(taskShellCommand(cmd, sudo))
+	if err != nil {
+		return commandError(output, err)
+	}
+	return nil
+}
+
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	connection, err := loadConnectionTasks()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+	result := map[string]interface{}{
+		"connection":  connection,
+		"projectFile": projectConfigPath(),
+	}
+	project, err := loadProjectTasks()
+	result["project"] = project
+	if err != nil {
+		result["projectError"] = err.Error()
+	}
+	sendSuccess(w, "", result)
+}
+
+func handleTasksSave(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		Tasks []Task `json:"tasks"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+	if req.Tasks == nil {
+		req.Tasks = []Task{}
+	}
+	if err := validateTasks(req.Tasks); err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	if err := saveConnectionTasks(req.Tasks); err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+	sendSuccess(w, "Tâches enregistrées", nil)
+}
+
+// handleTaskRun runs a task and streams its output as Server-Sent Events
+// ("output", with the stream name), followed by a "done" event carrying the
+// recorded run. Closing the stream cancels the task.
+func handleTaskRun(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	if err := checkCommandRequest(r); err != nil {
+		writeEvent(w, "done", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if server.sshClient == nil {
+		writeEvent(w, "done", map[string]interface{}{"error": "Non connecté"})
+		return
+	}
+
+	query := r.URL.Query()
+	task, err := findTask(query.Get("source"), query.Get("name"))
+	if err != nil {
+		writeEvent(w, "done", map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+		return
+	}
+
+	now := time.Now().UTC()
+	run := &TaskRun{
+		ID:      now.Format("20060102T150405") + fmt.Sprintf("%09d", now.Nanosecond()),
+		Host:    server.host,
+		Name:    task.Name,
+		Source:  task.Source,
+		Command: task.Command,
+		Dir:     taskDir(task),
+		User:    webUser(r),
+		Start:   now,
+	}
+	if err := saveTaskRun(run); err != nil {
+		log.Printf("historique des tâches: %v", err)
+	}
+	writeEvent(w, "start", run)
+
+	_, logPath := taskRunPaths(run.ID)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Printf("historique des tâches: %v", err)
+	} else {
+		defer logFile.Close()
+	}
+
+	var mu sync.Mutex
+	logged := 0
+	emit := func(stream string, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		output := TaskOutput{Stream: stream, Data: string(data)}
+		writeEvent(w, "output", output)
+		if logFile == nil || run.Truncated {
+			return
+		}
+		if logged+len(data) > maxTaskOutput {
+			run.Truncated = true
+			return
+		}
+		line, _ := json.Marshal(output)
+		logFile.Write(append(line, '\n'))
+		logged += len(data)
+	}
+
+	finish := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		end := time.Now().UTC()
+		run.End = &end
+		var exitErr *ssh.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			code := exitErr.ExitStatus()
+			run.Code = &code
+			if exitErr.Signal() != "" {
+				run.Error = "signal " + exitErr.Signal()
+			}
+		case err != nil:
+			run.Error = err.Error()
+		default:
+			code := 0
+			run.Code = &code
+		}
+		if err := saveTaskRun(run); err != nil {
+			log.Printf("historique des tâches: %v", err)
+		}
+		pruneTaskRuns()
+		writeEvent(w, "done", run)
+	}
+
+	session, err := server.sshClient.NewSession()
+	if err != nil {
+		finish(err)
+		return
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		finish(err)
+		return
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		finish(err)
+		return
+	}
+
+	// The script prints its PID first so that the task can be killed.
+	script := fmt.Sprintf("echo $$; cd %s || exit 1; %s", shellQuote(run.Dir), task.Command)
+	// A project file lives on the server and anyone who can write it would
+	// otherwise choose to run as root; only connection tasks may ask for sudo.
+	sudo := server.useSudo || (task.Sudo && task.Source == "connection")
+	if err := session.Start(taskShellCommand(script, sudo)); err != nil {
+		finish(err)
+		return
+	}
+
+	pids := make(chan int, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+			return
+		}
+		mu.Lock()
+		run.Cancelled = true
+		mu.Unlock()
+		select {
+		case pid := <-pids:
+			if err := killTask(pid, sudo); err != nil {
+				log.Printf("arrêt de la tâche %s: %v", task.Name, err)
+			}
+		case <-time.After(taskKillGrace):
+		case <-done:
+			return
+		}
+		select {
+		case <-time.After(taskKillGrace):
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	pump := func(stream string, src io.Reader, wg *sync.WaitGroup) {
+		defer wg.Done()
+		buf := make([]byte, 32*1024)
+		var pending []byte
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				pending = append(pending, buf[:n]...)
+				cut := completeUTF8(pending)
+				if cut > 0 {
+					emit(stream, pending[:cut])
+					pending = append([]byte(nil), pending[cut:]...)
+				}
+			}
+			if err != nil {
+				if len(pending) > 0 {
+					emit(stream, pending)
+				}
+				return
+			}
+		}
+	}
+
+	reader := bufio.NewReader(stdout)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go pump("stderr", stderr, &wg)
+	go func() {
+		if line, err := reader.ReadString('\n'); err == nil {
+			if pid, err := strconv.Atoi(strings.TrimSpace(line)); err == nil {
+				pids <- pid
+			}
+		}
+		pump("stdout", reader, &wg)
+	}()
+	wg.Wait()
+
+	finish(session.Wait())
+}
+
+func handleTaskRuns(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	runs, err := listTaskRuns()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+	sendSuccess(w, "", runs)
+}
+
+func handleTaskRunOutput(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if !validTaskRunID(id) {
+		sendError(w, "Exécution invalide")
+		return
+	}
+
+	meta, logPath := taskRunPaths(id)
+	data, err := os.ReadFile(meta)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Exécution introuvable: %v", err))
+		return
+	}
+	var run TaskRun
+	if err := json.Unmarshal(data, &run); err != nil || run.Host != server.host {
+		sendError(w, "Exécution introuvable")
+		return
+	}
+
+	output := []TaskOutput{}
+	if file, err := os.Open(logPath); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), maxTaskOutput+1024)
+		for scanner.Scan() {
+			var chunk TaskOutput
+			if json.Unmarshal(scanner.Bytes(), &chunk) == nil {
+				output = append(output, chunk)
+			}
+		}
+	}
+	sendSuccess(w, "", map[string]interface{}{
+		"run":    run,
+		"output": output,
+	})
+}
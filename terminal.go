@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultTerminalCols = 80
+	defaultTerminalRows = 24
+	maxTerminalSize     = 1000
+)
+
+// terminalMessage is a control message sent by the browser as a text frame.
+// Keystrokes come as "input", the visible size as "resize".
+type terminalMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+}
+
+// TerminalSet keeps the shell sessions open on the current connection so
+// that they end with it.
+type TerminalSet struct {
+	mu       sync.Mutex
+	sessions map[*ssh.Session]struct{}
+}
+
+func newTerminalSet() *TerminalSet {
+	return &TerminalSet{sessions: map[*ssh.Session]struct{}{}}
+}
+
+func (t *TerminalSet) add(session *ssh.Session) {
+	t.mu.Lock()
+	t.sessions[session] = struct{}{}
+	t.mu.Unlock()
+}
+
+func (t *TerminalSet) remove(session *ssh.Session) {
+	t.mu.Lock()
+	delete(t.sessions, session)
+	t.mu.Unlock()
+}
+
+func (t *TerminalSet) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for session := range t.sessions {
+		session.Close()
+	}
+	t.sessions = map[*ssh.Session]struct{}{}
+}
+
+func terminalSize(value string, fallback int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return min(n, maxTerminalSize)
+}
+
+func sendTerminalExit(ws *wsConn, exit map[string]interface{}) {
+	exit["type"] = "exit"
+	data, _ := json.Marshal(exit)
+	ws.WriteMessage(wsText, data)
+}
+
+// handleTerminal opens an interactive shell on the server and bridges its
+// PTY to a WebSocket: output is sent as binary frames, and a final "exit"
+// text message carries the exit code or the error.
+func handleTerminal(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close()
+
+	if server.sshClient == nil {
+		sendTerminalExit(ws, map[string]interface{}{"error": "Non connecté"})
+		return
+	}
+
+	query := r.URL.Query()
+	dir := cleanRemotePath(query.Get("path"))
+	if dir == "" {
+		dir = defaultParent()
+	}
+	cols := terminalSize(query.Get("cols"), defaultTerminalCols)
+	rows := terminalSize(query.Get("rows"), defaultTerminalRows)
+
+	session, err := server.sshClient.NewSession()
+	if err != nil {
+		sendTerminalExit(ws, map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+		return
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", rows, cols, modes); err != nil {
+		sendTerminalExit(ws, map[string]interface{}{"error": fmt.Sprintf("Pseudo-terminal refusé: %v", err)})
+		return
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		sendTerminalExit(ws, map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+		return
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		sendTerminalExit(ws, map[string]interface{}{"error": fmt.Sprintf("Erreur: %v", err)})
+		return
+	}
+	if err := session.Shell(); err != nil {
+		sendTerminalExit(ws, map[string]interface{}{"error": fmt.Sprintf("Shell refusé: %v", err)})
+		return
+	}
+
+	terminals := server.terminals
+	terminals.add(session)
+	defer terminals.remove(session)
+
+	// The leading space keeps the command out of the shell history.
+	fmt.Fprintf(stdin, " cd %s && clear\n", shellQuote(dir))
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				if ws.WriteMessage(wsBinary, buf[:n]) != nil {
+					session.Close()
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		exit := map[string]interface{}{"code": 0}
+		var exitErr *ssh.ExitError
+		if err := session.Wait(); errors.As(err, &exitErr) {
+			exit["code"] = exitErr.ExitStatus()
+		} else if err != nil {
+			exit["error"] = "Session terminée"
+		}
+		sendTerminalExit(ws, exit)
+		ws.Close()
+	}()
+
+	for {
+		opcode, data, err := ws.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("terminal interrompu: %v", err)
+			}
+			return
+		}
+
+		if opcode == wsBinary {
+			stdin.Write(data)
+			continue
+		}
+		var msg terminalMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Type {
+		case "input":
+			stdin.Write([]byte(msg.Data))
+		case "resize":
+			if msg.Cols > 0 && msg.Rows > 0 {
+				session.WindowChange(min(msg.Rows, maxTerminalSize), min(msg.Cols, maxTerminalSize))
+			}
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const trashDirName = ".ssh-editor-trash"
+
+type TrashItem struct {
+	ID           string    `json:"id"`
+	OriginalPath string    `json:"originalPath"`
+	DeletedAt    time.Time `json:"deletedAt"`
+	IsDir        bool      `json:"isDir"`
+	Size         int64     `json:"size"`
+}
+
+func trashRoot() (string, error) {
+	home, err := server.sftpClient.RealPath(".")
+	if err != nil {
+		return "", fmt.Errorf("dossier personnel introuvable: %v", err)
+	}
+	return path.Join(home, trashDirName), nil
+}
+
+func trashPaths(root, id string) (string, string) {
+	return path.Join(root, "files", id), path.Join(root, "info", id+".json")
+}
+
+func isInTrash(p string) bool {
+	root, err := trashRoot()
+	if err != nil {
+		return false
+	}
+	return p == root || strings.HasPrefix(p, root+"/")
+}
+
+func moveToTrash(p string) (*TrashItem, error) {
+	info, err := server.sftpClient.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := trashRoot()
+	if err != nil {
+		return nil, err
+	}
+	// The trash cannot be moved into itself, and copying it there would
+	// never end.
+	if p = path.Clean(p); root == p || strings.HasPrefix(root, strings.TrimSuffix(p, "/")+"/") {
+		return nil, fmt.Errorf("%s contient la corbeille et ne peut pas y être placé", p)
+	}
+	for _, dir := range []string{path.Join(root, "files"), path.Join(root, "info")} {
+		if err := server.sftpClient.MkdirAll(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	item := &TrashItem{
+		ID:           fmt.Sprintf("%s-%s", now.Format("20060102-150405.000000"), path.Base(p)),
+		OriginalPath: p,
+		DeletedAt:    now,
+		IsDir:        info.IsDir(),
+	}
+	if !item.IsDir {
+		item.Size = info.Size()
+	}
+
+	filesPath, infoPath := trashPaths(root, item.ID)
+	if err := writeTrashInfo(infoPath, item); err != nil {
+		return nil, err
+	}
+
+	if err := moveRemote(p, filesPath); err != nil {
+		server.sftpClient.Remove(infoPath)
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func moveRemote(src, dst string) error {
+	if server.useSudo {
+		output, err := runRemoteCommand(fmt.Sprintf("mv -- %s %s", shellQuote(src), shellQuote(dst)))
+		if err != nil {
+			return commandError(output, err)
+		}
+		return nil
+	}
+
+	if err := server.sftpClient.PosixRename(src, dst); err == nil {
+		return nil
+	}
+	if err := server.sftpClient.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if _, err := copyRemote(src, dst); err != nil {
+		return err
+	}
+	return removeAllWithSFTP(src)
+}
+
+func writeTrashInfo(infoPath string, item *TrashItem) error {
+	file, err := server.sftpClient.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(item); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readTrashInfo(infoPath string) (*TrashItem, error) {
+	file, err := server.sftpClient.Open(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var item TrashItem
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func handleTrash(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	root, err := trashRoot()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	entries, err := server.sftpClient.ReadDir(path.Join(root, "info"))
+	if err != nil {
+		sendSuccess(w, "", []*TrashItem{})
+		return
+	}
+
+	items := []*TrashItem{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		item, err := readTrashInfo(path.Join(root, "info", entry.Name()))
+		if err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+
+	sendSuccess(w, "", items)
+}
+
+func handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !validTrashID(req.ID) {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	root, err := trashRoot()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	filesPath, infoPath := trashPaths(root, req.ID)
+	item, err := readTrashInfo(infoPath)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Élément introuvable: %v", err))
+		return
+	}
+
+	if _, err := server.sftpClient.Lstat(item.OriginalPath); err == nil {
+		sendError(w, fmt.Sprintf("%s existe déjà", item.OriginalPath))
+		return
+	}
+
+	if err := server.sftpClient.MkdirAll(path.Dir(item.OriginalPath)); err != nil && !server.useSudo {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	if err := moveRemote(filesPath, item.OriginalPath); err != nil {
+		sendError(w, fmt.Sprintf("Erreur de restauration: %v", err))
+		return
+	}
+	server.sftpClient.Remove(infoPath)
+
+	sendSuccess(w, "Restauré", item)
+}
+
+func handleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	root, err := trashRoot()
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	var ids []string
+	if req.ID == "" {
+		entries, _ := server.sftpClient.ReadDir(path.Join(root, "info"))
+		for _, entry := range entries {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+		}
+	} else if validTrashID(req.ID) {
+		ids = []string{req.ID}
+	} else {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	for _, id := range ids {
+		filesPath, infoPath := trashPaths(root, id)
+		if err := removeRemote(filesPath); err != nil && !os.IsNotExist(err) {
+			sendError(w, fmt.Sprintf("Erreur: %v", err))
+			return
+		}
+		server.sftpClient.Remove(infoPath)
+	}
+
+	sendSuccess(w, fmt.Sprintf("%d élément(s) supprimé(s) définitivement", len(ids)), nil)
+}
+
+func validTrashID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.Contains(id, "/")
+}
+
+func removeRemote(p string) error {
+	if server.useSudo {
+		return deleteWithSudo(p)
+	}
+	return removeAllWithSFTP(p)
+}
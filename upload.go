@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+type UploadResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	parent := defaultParent()
+	overwrite := false
+	relPath := ""
+	uploaded := []UploadResult{}
+	skipped := []string{}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sendError(w, fmt.Sprintf("Erreur de réception: %v", err))
+			return
+		}
+
+		switch part.FormName() {
+		case "parent", "overwrite", "path":
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			part.Close()
+			if err != nil {
+				sendError(w, "Requête invalide")
+				return
+			}
+			switch part.FormName() {
+			case "parent":
+				if p := cleanRemotePath(string(value)); p != "" {
+					parent = p
+				}
+			case "overwrite":
+				overwrite = string(value) == "true"
+			case "path":
+				relPath = string(value)
+			}
+
+		case "file":
+			name := relPath
+			if name == "" {
+				name = part.FileName()
+			}
+			relPath = ""
+
+			target := path.Join(parent, strings.Trim(name, "/"))
+			if name == "" || !strings.HasPrefix(target, strings.TrimSuffix(parent, "/")+"/") {
+				part.Close()
+				sendError(w, fmt.Sprintf("Nom de fichier invalide: %s", name))
+				return
+			}
+
+			if !overwrite {
+				if _, err := server.sftpClient.Lstat(target); err == nil {
+					io.Copy(io.Discard, part)
+					part.Close()
+					skipped = append(skipped, name)
+					continue
+				}
+			}
+
+			var size int64
+			if server.useSudo {
+				size, err = writeStreamWithSudo(target, part)
+			} else {
+				size, err = writeStreamWithSFTP(target, part)
+			}
+			part.Close()
+			if err != nil {
+				sendError(w, fmt.Sprintf("Erreur d'écriture de %s: %v", target, err))
+				return
+			}
+			uploaded = append(uploaded, UploadResult{Path: target, Size: size})
+
+		default:
+			part.Close()
+		}
+	}
+
+	sendSuccess(w, fmt.Sprintf("%d fichier(s) téléversé(s)", len(uploaded)), map[string]interface{}{
+		"uploaded": uploaded,
+		"skipped":  skipped,
+	})
+}
+
+func writeStreamWithSFTP(target string, src io.Reader) (int64, error) {
+	if err := server.sftpClient.MkdirAll(path.Dir(target)); err != nil {
+		return 0, err
+	}
+
+	file, err := server.sftpClient.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(file, src)
+	if err != nil {
+		file.Close()
+		return n, err
+	}
+	return n, file.Close()
+}
+
+func writeStreamWithSudo(target string, src io.Reader) (int64, error) {
+	staging, n, err := stageFile(src)
+	if staging != "" {
+		defer server.sftpClient.Remove(staging)
+	}
+	if err != nil {
+		return n, err
+	}
+
+	// The staging file is private; new targets get the usual umask mode
+	// instead, and existing ones keep their own.
+	output, err := runRemoteCommand(fmt.Sprintf("mkdir -p -- %s && cp --no-preserve=mode -- %s %s",
+		shellQuote(path.Dir(target)), shellQuote(staging), shellQuote(target)))
+	if err != nil {
+		return n, commandError(output, err)
+	}
+	return n, nil
+}
+
+// stageFile copies src into a private file under /tmp, from where a
+// privileged command can move it into place.
+func stageFile(src io.Reader) (string, int64, error) {
+	staging, err := stagingPath()
+	if err != nil {
+		return "", 0, err
+	}
+
+	file, err := server.sftpClient.OpenFile(staging, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return staging, 0, err
+	}
+
+	n, err := io.Copy(file, src)
+	if err != nil {
+		file.Close()
+		return staging, n, err
+	}
+	return staging, n, file.Close()
+}
+
+func stagingPath() (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return "/tmp/.ssh-editor-" + hex.EncodeToString(suffix), nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRangeBytes  = 1 << 20
+	maxRangeLines  = 5000
+	lineCheckpoint = 1000
+)
+
+var maxEditSize int64 = 5 << 20
+
+type lineIndex struct {
+	size        int64
+	modTime     time.Time
+	checkpoints []int64
+}
+
+// lineIndexes caches line offsets per connection and path; an entry is only
+// reused while the file keeps the same size and modification time.
+var (
+	lineIndexes  = map[string]*lineIndex{}
+	lineIndexesM sync.Mutex
+)
+
+func resetLineIndexes() {
+	lineIndexesM.Lock()
+	lineIndexes = map[string]*lineIndex{}
+	lineIndexesM.Unlock()
+}
+
+type FileRange struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Offset     int64  `json:"offset"`
+	NextOffset int64  `json:"nextOffset"`
+	Line       int    `json:"line"`
+	NextLine   int    `json:"nextLine"`
+	Content    string `json:"content"`
+	EOF        bool   `json:"eof"`
+	LongLine   bool   `json:"longLine,omitempty"`
+}
+
+func remoteSize(p string) (int64, error) {
+	info, err := server.sftpClient.Stat(p)
+	if err == nil {
+		return info.Size(), nil
+	}
+	if !server.useSudo {
+		return 0, err
+	}
+
+	output, err2 := runRemoteCommand("stat -L -c %s -- " + shellQuote(p))
+	if err2 != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+}
+
+func handleFileRange(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	query := r.URL.Query()
+	p := cleanRemotePath(query.Get("path"))
+	if p == "" {
+		sendError(w, "Chemin requis")
+		return
+	}
+
+	size, err := remoteSize(p)
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur: %v", err))
+		return
+	}
+
+	var result *FileRange
+	if query.Has("line") {
+		line, _ := strconv.Atoi(query.Get("line"))
+		count, _ := strconv.Atoi(query.Get("count"))
+		if line < 0 {
+			line = 0
+		}
+		if count <= 0 || count > maxRangeLines {
+			count = maxRangeLines
+		}
+		if server.useSudo {
+			result, err = readLinesWithSudo(p, line, count)
+		} else {
+			result, err = readLinesWithSFTP(p, line, count)
+		}
+	} else {
+		offset, _ := strconv.ParseInt(query.Get("offset"), 10, 64)
+		length, _ := strconv.ParseInt(query.Get("length"), 10, 64)
+		if offset < 0 {
+			offset += size
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		if length <= 0 || length > maxRangeBytes {
+			length = maxRangeBytes
+		}
+		var data []byte
+		data, err = readRange(p, offset, length)
+		result = &FileRange{
+			Offset:     offset,
+			NextOffset: offset + int64(len(data)),
+			Content:    string(data),
+			EOF:        offset+int64(len(data)) >= size,
+		}
+	}
+
+	if err != nil {
+		sendError(w, fmt.Sprintf("Erreur de lecture: %v", err))
+		return
+	}
+
+	result.Path = p
+	result.Size = size
+	sendSuccess(w, "", result)
+}
+
+func readRange(p string, offset, length int64) ([]byte, error) {
+	if server.useSudo {
+		var data bytes.Buffer
+		if err := streamRange(p, offset, length, &data); err != nil {
+			return nil, err
+		}
+		return data.Bytes(), nil
+	}
+
+	file, err := server.sftpClient.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, length)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// streamRange copies length bytes of p from offset to w, as root.
+func streamRange(p string, offset, length int64, w io.Writer) error {
+	return streamRemoteCommand(fmt.Sprintf("tail -c +%d -- %s | head -c %d", offset+1, shellQuote(p), length), w)
+}
+
+func readLinesWithSFTP(p string, start, count int) (*FileRange, error) {
+	file, err := server.sftpClient.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	key := server.host + ":" + p
+	lineIndexesM.Lock()
+	index := lineIndexes[key]
+	if index == nil || index.size != info.Size() || !index.modTime.Equal(info.ModTime()) {
+		index = &lineIndex{size: info.Size(), modTime: info.ModTime(), checkpoints: []int64{0}}
+		lineIndexes[key] = index
+	}
+	checkpoint := start / lineCheckpoint
+	if checkpoint >= len(index.checkpoints) {
+		checkpoint = len(index.checkpoints) - 1
+	}
+	offset := index.checkpoints[checkpoint]
+	lineIndexesM.Unlock()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReaderSize(file, 64*1024)
+
+	line := checkpoint * lineCheckpoint
+	result := &FileRange{Line: start}
+	var content bytes.Buffer
+	pageStart := int64(-1)
+
+	// Lines are read in chunks so that neither the skipped lines nor the page
+	// are ever held beyond maxRangeBytes.
+	for line < start+count {
+		if line%lineCheckpoint == 0 {
+			lineIndexesM.Lock()
+			if line/lineCheckpoint == len(index.checkpoints) {
+				index.checkpoints = append(index.checkpoints, offset)
+			}
+			lineIndexesM.Unlock()
+		}
+		if line == start {
+			pageStart = offset
+		}
+
+		lineStart := offset
+		pageLen := content.Len()
+		var err error
+		for {
+			var chunk []byte
+			chunk, err = reader.ReadSlice('\n')
+			offset += int64(len(chunk))
+			if line >= start {
+				content.Write(chunk)
+			}
+			if err != bufio.ErrBufferFull {
+				break
+			}
+			if content.Len() > maxRangeBytes {
+				break
+			}
+		}
+
+		if content.Len() > maxRangeBytes {
+			if line == start {
+				// A single line is larger than a page: the caller has to
+				// switch to byte ranges.
+				return &FileRange{Line: start, NextLine: start, Offset: lineStart, NextOffset: lineStart, LongLine: true}, nil
+			}
+			content.Truncate(pageLen)
+			offset = lineStart
+			break
+		}
+		if err == io.EOF {
+			if offset > lineStart {
+				line++
+			}
+			result.EOF = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+	}
+
+	if !result.EOF && offset >= info.Size() {
+		result.EOF = true
+	}
+	if line < start {
+		result.Line = line
+	}
+	if pageStart < 0 {
+		pageStart = offset
+	}
+	result.NextLine = line
+	result.Offset = pageStart
+	result.NextOffset = offset
+	result.Content = content.String()
+	return result, nil
+}
+
+// readLinesWithSudo reads at most maxRangeBytes of the requested lines; the
+// page stops at the last complete line that fits.
+func readLinesWithSudo(p string, start, count int) (*FileRange, error) {
+	var output bytes.Buffer
+	cmd := fmt.Sprintf("sed -n '%d,%dp;%dq' -- %s | head -c %d", start+1, start+count, start+count, shellQuote(p), maxRangeBytes+1)
+	if err := streamRemoteCommand(cmd, &output); err != nil {
+		return nil, err
+	}
+
+	data := output.Bytes()
+	truncated := len(data) > maxRangeBytes
+	if truncated {
+		end := bytes.LastIndexByte(data[:maxRangeBytes], '\n')
+		if end < 0 {
+			var prefix bytes.Buffer
+			if err := streamRemoteCommand(fmt.Sprintf("head -n %d -- %s | wc -c", start, shellQuote(p)), &prefix); err != nil {
+				return nil, err
+			}
+			offset, err := strconv.ParseInt(strings.TrimSpace(prefix.String()), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			return &FileRange{Line: start, NextLine: start, Offset: offset, NextOffset: offset, LongLine: true}, nil
+		}
+		data = data[:end+1]
+	}
+
+	lines := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	return &FileRange{
+		Line:     start,
+		NextLine: start + lines,
+		Content:  string(data),
+		EOF:      !truncated && lines < count,
+	}, nil
+}
+
+func isTooLargeToEdit(p string) (int64, bool) {
+	size, err := remoteSize(p)
+	if err != nil {
+		return 0, false
+	}
+	return size, size > maxEditSize
+}
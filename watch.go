@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	watchPollInterval = 2 * time.Second
+	watchKeepAlive    = 20 * time.Second
+)
+
+type WatchEvent struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+}
+
+type watchEntry struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+type Watcher struct {
+	mu          sync.Mutex
+	file        string
+	dirs        map[string]bool
+	subscribers map[chan WatchEvent]struct{}
+	restart     chan struct{}
+	stop        chan struct{}
+	backend     string
+}
+
+func newWatcher() *Watcher {
+	return &Watcher{
+		dirs:        map[string]bool{},
+		subscribers: map[chan WatchEvent]struct{}{},
+		restart:     make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+func (w *Watcher) Close() {
+	close(w.stop)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subscribers {
+		close(ch)
+	}
+	w.subscribers = map[chan WatchEvent]struct{}{}
+}
+
+func (w *Watcher) subscribe() chan WatchEvent {
+	ch := make(chan WatchEvent, 64)
+	w.mu.Lock()
+	w.subscribers[ch] = struct{}{}
+	w.mu.Unlock()
+	return ch
+}
+
+func (w *Watcher) unsubscribe(ch chan WatchEvent) {
+	w.mu.Lock()
+	if _, ok := w.subscribers[ch]; ok {
+		delete(w.subscribers, ch)
+		close(ch)
+	}
+	w.mu.Unlock()
+}
+
+func (w *Watcher) broadcast(event WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (w *Watcher) setPaths(file string, dirs []string) {
+	w.mu.Lock()
+	w.file = file
+	w.dirs = map[string]bool{}
+	for _, dir := range dirs {
+		w.dirs[dir] = true
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.restart <- struct{}{}:
+	default:
+	}
+}
+
+// watchedDirs returns the directories to observe: the expanded folders plus
+// the parent of the open file, whose events are filtered down to that file.
+func (w *Watcher) watchedDirs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	set := map[string]bool{}
+	for dir := range w.dirs {
+		set[dir] = true
+	}
+	if w.file != "" {
+		set[path.Dir(w.file)] = true
+	}
+
+	dirs := make([]string, 0, len(set))
+	for dir := range set {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+func (w *Watcher) wants(p string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return p == w.file || w.dirs[p] || w.dirs[path.Dir(p)]
+}
+
+func (w *Watcher) setBackend(backend string) {
+	w.mu.Lock()
+	w.backend = backend
+	w.mu.Unlock()
+}
+
+func (w *Watcher) currentBackend() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.backend
+}
+
+func (w *Watcher) emit(event WatchEvent) {
+	if w.wants(event.Path) {
+		w.broadcast(event)
+	}
+}
+
+func (w *Watcher) run() {
+	inotify := true
+	for {
+		dirs := w.watchedDirs()
+		if len(dirs) == 0 {
+			select {
+			case <-w.stop:
+				return
+			case <-w.restart:
+				continue
+			}
+		}
+
+		if inotify && remoteCommandExists("inotifywait") {
+			w.setBackend("inotify")
+			if err := w.runInotify(dirs); err != nil {
+				log.Printf("inotifywait indisponible, bascule sur le polling: %v", err)
+				inotify = false
+			}
+		} else {
+			w.setBackend("poll")
+			w.runPolling(dirs)
+		}
+
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+	}
+}
+
+func (w *Watcher) runInotify(dirs []string) error {
+	session, err := server.sshClient.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// A PTY makes the remote inotifywait receive SIGHUP when the session closes.
+	modes := ssh.TerminalModes{ssh.ECHO: 0}
+	if err := session.RequestPty("dumb", 80, 40, modes); err != nil {
+		return err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, len(dirs))
+	for i, dir := range dirs {
+		quoted[i] = shellQuote(dir)
+	}
+	cmd := "inotifywait -m -q -e create,modify,close_write,delete,moved_to,moved_from,delete_self --format '%e|%w%f' -- " + strings.Join(quoted, " ")
+	if server.useSudo {
+		cmd = sudoCommand(cmd)
+	}
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if event, ok := parseInotifyLine(strings.TrimRight(scanner.Text(), "\r")); ok {
+				w.emit(event)
+			}
+		}
+		done <- session.Wait()
+	}()
+
+	select {
+	case <-w.stop:
+		return nil
+	case <-w.restart:
+		return nil
+	case err := <-done:
+		if err == nil {
+			err = fmt.Errorf("inotifywait s'est arrêté")
+		}
+		return err
+	}
+}
+
+func parseInotifyLine(line string) (WatchEvent, bool) {
+	flags, p, ok := strings.Cut(line, "|")
+	if !ok {
+		return WatchEvent{}, false
+	}
+
+	event := WatchEvent{Path: path.Clean(p)}
+	for _, flag := range strings.Split(flags, ",") {
+		switch flag {
+		case "CREATE", "MOVED_TO":
+			event.Type = "create"
+		case "MODIFY", "CLOSE_WRITE":
+			event.Type = "modify"
+		case "DELETE", "MOVED_FROM", "DELETE_SELF":
+			event.Type = "delete"
+		case "ISDIR":
+			event.IsDir = true
+		}
+	}
+	return event, event.Type != ""
+}
+
+func (w *Watcher) runPolling(dirs []string) {
+	previous := map[string]watchEntry{}
+	for _, dir := range dirs {
+		pollDir(dir, previous)
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.restart:
+			return
+		case <-ticker.C:
+		}
+
+		current := map[string]watchEntry{}
+		for _, dir := range dirs {
+			pollDir(dir, current)
+		}
+
+		for p, entry := range current {
+			old, ok := previous[p]
+			switch {
+			case !ok:
+				w.emit(WatchEvent{Type: "create", Path: p, IsDir: entry.isDir})
+			case !entry.isDir && (!old.modTime.Equal(entry.modTime) || old.size != entry.size):
+				w.emit(WatchEvent{Type: "modify", Path: p})
+			}
+		}
+		for p, entry := range previous {
+			if _, ok := current[p]; !ok {
+				w.emit(WatchEvent{Type: "delete", Path: p, IsDir: entry.isDir})
+			}
+		}
+		previous = current
+	}
+}
+
+func pollDir(dir string, snapshot map[string]watchEntry) {
+	entries, err := server.sftpClient.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		snapshot[path.Join(dir, entry.Name())] = watchEntry{
+			modTime: entry.ModTime(),
+			size:    entry.Size(),
+			isDir:   entry.Mode()&os.ModeDir != 0,
+		}
+	}
+}
+
+func handleWatch(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil || server.watcher == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, "Streaming non supporté")
+		return
+	}
+
+	watcher := server.watcher
+	events := watcher.subscribe()
+	defer watcher.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprint(w, ": connecté\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+func handleWatchPaths(w http.ResponseWriter, r *http.Request) {
+	if server.sftpClient == nil || server.watcher == nil {
+		sendError(w, "Non connecté")
+		return
+	}
+
+	var req struct {
+		File string   `json:"file"`
+		Dirs []string `json:"dirs"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, "Requête invalide")
+		return
+	}
+
+	dirs := []string{defaultParent()}
+	for _, dir := range req.Dirs {
+		if dir = cleanRemotePath(dir); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	server.watcher.setPaths(cleanRemotePath(req.File), dirs)
+	sendSuccess(w, "", map[string]interface{}{
+		"backend": server.watcher.currentBackend(),
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Minimal server side WebSocket (RFC 6455), enough for the terminal: no
+// extensions, no subprotocols, and outgoing messages sent as single frames.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const maxWebSocketMessage = 1 << 20
+
+// Control frames carry at most 125 bytes and are never fragmented (RFC 6455
+// section 5.5).
+const maxWebSocketControl = 125
+
+// Close status codes sent when the peer breaks the protocol.
+const (
+	wsStatusProtocolError = 1002
+	wsStatusTooBig        = 1009
+)
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsError is a protocol violation by the peer; ReadMessage fails the
+// connection with its status code.
+type wsError struct {
+	status uint16
+	msg    string
+}
+
+func (e *wsError) Error() string { return e.msg }
+
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+	closed bool
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket performs the opening handshake. Requests from another
+// origin are refused: browsers do not apply the same-origin policy to
+// WebSockets, and the terminal gives shell access to the server.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		return nil, errors.New("connexion WebSocket attendue")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errors.New("version WebSocket non supportée")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("clé WebSocket manquante")
+	}
+	if err := checkSameOrigin(r); err != nil {
+		return nil, err
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connexion non détournable")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.reader, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	control := opcode&0x8 != 0
+	if head[0]&0x70 != 0 {
+		err = &wsError{wsStatusProtocolError, "bits réservés WebSocket non nuls"}
+		return
+	}
+	if head[1]&0x80 == 0 {
+		err = &wsError{wsStatusProtocolError, "trame WebSocket non masquée"}
+		return
+	}
+	if control && !fin {
+		err = &wsError{wsStatusProtocolError, "trame de contrôle WebSocket fragmentée"}
+		return
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if control && length > maxWebSocketControl {
+		err = &wsError{wsStatusProtocolError, "trame de contrôle WebSocket trop longue"}
+		return
+	}
+	if length > maxWebSocketMessage {
+		err = &wsError{wsStatusTooBig, "message WebSocket trop long"}
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// ReadMessage returns the next text or binary message, answering pings on
+// the way. It returns io.EOF once the peer closed the connection, and fails
+// the connection with a close frame when the peer breaks the protocol.
+func (c *wsConn) ReadMessage() (byte, []byte, error) {
+	opcode, message, err := c.readMessage()
+	var protocolErr *wsError
+	if errors.As(err, &protocolErr) {
+		c.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, protocolErr.status), protocolErr.msg...))
+	}
+	return opcode, message, err
+}
+
+func (c *wsConn) readMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return 0, nil, io.EOF
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return 0, nil, &wsError{wsStatusProtocolError, "message WebSocket commencé avant la fin du précédent"}
+			}
+			opcode = op
+			message = payload
+		case wsContinuation:
+			if opcode == 0 {
+				return 0, nil, &wsError{wsStatusProtocolError, "trame de continuation inattendue"}
+			}
+			if len(message)+len(payload) > maxWebSocketMessage {
+				return 0, nil, &wsError{wsStatusTooBig, "message WebSocket trop long"}
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, &wsError{wsStatusProtocolError, fmt.Sprintf("opcode WebSocket inconnu: %d", op)}
+		}
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	if opcode == wsClose {
+		c.closed = true
+	}
+	return nil
+}
+
+func (c *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	return c.writeFrame(opcode, payload)
+}
+
+// Close sends a close frame, if not done yet, and closes the connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, 1000))
+	return c.conn.Close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// clientFrame builds a masked frame as a browser would send it.
+func clientFrame(head byte, payload []byte) []byte {
+	frame := []byte{head}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     [][]byte
+		want       string
+		wantStatus uint16
+	}{
+		{"text", [][]byte{clientFrame(0x80|wsText, []byte("hi"))}, "hi", 0},
+		{
+			"fragmented with ping", [][]byte{
+				clientFrame(wsText, []byte("a")),
+				clientFrame(0x80|wsPing, []byte("p")),
+				clientFrame(0x80|wsContinuation, []byte("b")),
+			}, "ab", 0,
+		},
+		{"fragmented ping", [][]byte{clientFrame(wsPing, nil)}, "", wsStatusProtocolError},
+		{"long ping", [][]byte{clientFrame(0x80|wsPing, make([]byte, 126))}, "", wsStatusProtocolError},
+		{"reserved bits", [][]byte{clientFrame(0x80|0x40|wsText, nil)}, "", wsStatusProtocolError},
+		{
+			"interleaved message", [][]byte{
+				clientFrame(wsText, []byte("a")),
+				clientFrame(0x80|wsText, []byte("b")),
+			}, "", wsStatusProtocolError,
+		},
+		{"stray continuation", [][]byte{clientFrame(0x80|wsContinuation, nil)}, "", wsStatusProtocolError},
+		{"too big", [][]byte{clientFrame(0x80|wsBinary, make([]byte, maxWebSocketMessage+1))}, "", wsStatusTooBig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			ws := &wsConn{conn: server, reader: bufio.NewReader(server)}
+			defer ws.Close()
+
+			go func() {
+				for _, frame := range tt.frames {
+					if _, err := client.Write(frame); err != nil {
+						return
+					}
+				}
+			}()
+			// Collect what the server sends back: pongs, then a close frame.
+			replies := make(chan []byte, 1)
+			go func() {
+				var buf bytes.Buffer
+				io.Copy(&buf, client)
+				replies <- buf.Bytes()
+			}()
+
+			_, message, err := ws.ReadMessage()
+			if tt.wantStatus == 0 {
+				if err != nil || string(message) != tt.want {
+					t.Fatalf("ReadMessage() = %q, %v; want %q", message, err, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ReadMessage() = %q, want an error", message)
+			}
+			ws.conn.Close()
+			reply := <-replies
+			if len(reply) < 4 || reply[0] != 0x80|wsClose || binary.BigEndian.Uint16(reply[2:4]) != tt.wantStatus {
+				t.Errorf("server replied %q, want close with status %d", reply, tt.wantStatus)
+			}
+		})
+	}
+}